@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"git.skobk.in/skobkin/ip-detect/internal/server"
+)
+
+func configCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "config: expected print or validate")
+
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "print":
+		return printConfig(args[1:])
+	case "validate":
+		return validateConfig(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "config: unknown command %q, expected print or validate\n", args[0])
+
+		return exitUsage
+	}
+}
+
+// printConfig prints the configuration after merging the file, the environment
+// and flags, as a configuration file or as environment variables.
+func printConfig(args []string) int {
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	format := fs.String("format", "yaml", "output `format`: yaml or env")
+
+	cfg, _, code, ok := loadConfig(fs, args)
+	if !ok {
+		return code
+	}
+
+	var err error
+
+	switch *format {
+	case "yaml":
+		err = cfg.WriteYAML(os.Stdout)
+	case "env":
+		err = cfg.WriteEnv(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected yaml or env\n", *format)
+
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// validateConfig loads the configuration and sets up the server without listening,
+// which also checks that certificate and CA files can be loaded.
+func validateConfig(args []string) int {
+	cfg, _, code, ok := loadConfig(flag.NewFlagSet("config validate", flag.ContinueOnError), args)
+	if !ok {
+		return code
+	}
+
+	if _, err := server.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+
+		return exitError
+	}
+
+	fmt.Fprintln(os.Stdout, "configuration is valid")
+
+	return exitOK
+}
@@ -2,44 +2,66 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
 	"git.skobk.in/skobkin/ip-detect/internal/config"
-	"git.skobk.in/skobkin/ip-detect/internal/server"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
 )
 
 func main() {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+	os.Exit(run(os.Args[1:]))
+}
 
-		os.Exit(1)
+// run dispatches to a subcommand. Without one, or when the arguments start with a
+// flag, the server is started so that existing invocations keep working.
+func run(args []string) int {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	logger := newLogger(cfg.Logging)
+	switch command {
+	case "serve":
+		return serve(args)
+	case "version":
+		return printVersion(args)
+	case "config":
+		return configCommand(args)
+	case "help":
+		usage(os.Stdout)
 
-	srv, err := server.New(cfg, logger)
-	if err != nil {
-		logger.Error("failed to initialize server", "error", err)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage(os.Stderr)
 
-		os.Exit(1)
+		return exitUsage
 	}
+}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-
-	err = srv.Run(ctx)
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: ip-detect [command] [flags]
 
-	stop()
+Commands:
+  serve             start the server (default)
+  version           print version information
+  config print      print the effective configuration
+  config validate   check the configuration and exit
 
-	if err != nil {
-		logger.Error("server stopped with error", "error", err)
-		os.Exit(1)
-	}
+Every setting can be passed as a flag, an IPD_ environment variable or in the
+configuration file, in increasing order of precedence: file, environment, flags.
+Run "ip-detect serve -h" for the list of flags.
+`)
 }
 
 func newLogger(cfg config.LoggingConfig) *slog.Logger {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/server"
+)
+
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+
+	cfg, flags, code, ok := loadConfig(fs, args)
+	if !ok {
+		return code
+	}
+
+	logger := newLogger(cfg.Logging)
+
+	for _, warning := range cfg.Warnings {
+		logger.Warn(warning)
+	}
+
+	srv, err := server.New(cfg, logger)
+	if err != nil {
+		logger.Error("failed to initialize server", "error", err)
+
+		return exitError
+	}
+
+	srv.EnableConfigReload(flags.Load, flags.Path())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	err = srv.Run(ctx)
+
+	stop()
+
+	if err != nil {
+		logger.Error("server stopped with error", "error", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// loadConfig adds the configuration flags to the flag set of a command, parses
+// args and loads the configuration. When ok is false the command must exit with code.
+func loadConfig(fs *flag.FlagSet, args []string) (config.Config, *config.Flags, int, bool) {
+	flags := config.BindFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return config.Config{}, nil, exitOK, false
+		}
+
+		return config.Config{}, nil, exitUsage, false
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+
+		return config.Config{}, nil, exitUsage, false
+	}
+
+	cfg, err := flags.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+
+		return config.Config{}, nil, exitError, false
+	}
+
+	return cfg, flags, exitOK, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3". When empty,
+// the module version or VCS revision recorded by the Go toolchain is used.
+var version string
+
+func printVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	fmt.Fprintf(os.Stdout, "ip-detect %s (%s, %s/%s)\n", buildVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	return exitOK
+}
+
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	var revision, modified string
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+
+	if revision == "" {
+		return "dev"
+	}
+
+	const shortRevision = 12
+	if len(revision) > shortRevision {
+		revision = revision[:shortRevision]
+	}
+
+	if modified == "true" {
+		revision += "-dirty"
+	}
+
+	return "dev-" + revision
+}
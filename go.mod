@@ -1,3 +1,19 @@
 module git.skobk.in/skobkin/ip-detect
 
-go 1.25
+go 1.25.0
+
+require (
+	github.com/oschwald/maxminddb-golang v1.13.1
+	github.com/pelletier/go-toml/v2 v2.3.1
+	github.com/pires/go-proxyproto v0.7.0
+	github.com/quic-go/quic-go v0.59.1
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.56.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
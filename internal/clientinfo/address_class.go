@@ -0,0 +1,112 @@
+package clientinfo
+
+import "net/netip"
+
+// specialPurpose is an entry of the IANA IPv4 and IPv6 special-purpose address
+// registries (RFC 6890).
+type specialPurpose struct {
+	block       netip.Prefix
+	name        string
+	reference   string
+	forwardable bool
+	global      bool
+	reserved    bool
+}
+
+func special(block, name, reference string, forwardable, global, reserved bool) specialPurpose {
+	return specialPurpose{
+		block:       netip.MustParsePrefix(block),
+		name:        name,
+		reference:   reference,
+		forwardable: forwardable,
+		global:      global,
+		reserved:    reserved,
+	}
+}
+
+// specialPurposeRegistry lists the registry entries. Deprecated entries are left out.
+// "N/A" in the registry is recorded as false. Multicast ranges come from separate
+// registries but are included, as their reachability depends on the scope.
+var specialPurposeRegistry = []specialPurpose{
+	special("0.0.0.0/8", "This network", "RFC 791", false, false, true),
+	special("0.0.0.0/32", "This host on this network", "RFC 1122", false, false, true),
+	special("10.0.0.0/8", "Private-Use", "RFC 1918", true, false, false),
+	special("100.64.0.0/10", "Shared Address Space", "RFC 6598", true, false, false),
+	special("127.0.0.0/8", "Loopback", "RFC 1122", false, false, true),
+	special("169.254.0.0/16", "Link Local", "RFC 3927", false, false, true),
+	special("172.16.0.0/12", "Private-Use", "RFC 1918", true, false, false),
+	special("192.0.0.0/24", "IETF Protocol Assignments", "RFC 6890", false, false, false),
+	special("192.0.0.0/29", "IPv4 Service Continuity Prefix", "RFC 7335", true, false, false),
+	special("192.0.0.8/32", "IPv4 dummy address", "RFC 7600", false, false, false),
+	special("192.0.0.9/32", "Port Control Protocol Anycast", "RFC 7723", true, true, false),
+	special("192.0.0.10/32", "Traversal Using Relays around NAT Anycast", "RFC 8155", true, true, false),
+	special("192.0.0.170/32", "NAT64/DNS64 Discovery", "RFC 8880", false, false, true),
+	special("192.0.0.171/32", "NAT64/DNS64 Discovery", "RFC 8880", false, false, true),
+	special("192.0.2.0/24", "Documentation (TEST-NET-1)", "RFC 5737", false, false, false),
+	special("192.31.196.0/24", "AS112-v4", "RFC 7535", true, true, false),
+	special("192.52.193.0/24", "AMT", "RFC 7450", true, true, false),
+	special("192.168.0.0/16", "Private-Use", "RFC 1918", true, false, false),
+	special("192.175.48.0/24", "Direct Delegation AS112 Service", "RFC 7534", true, true, false),
+	special("198.18.0.0/15", "Benchmarking", "RFC 2544", true, false, false),
+	special("198.51.100.0/24", "Documentation (TEST-NET-2)", "RFC 5737", false, false, false),
+	special("203.0.113.0/24", "Documentation (TEST-NET-3)", "RFC 5737", false, false, false),
+	special("224.0.0.0/4", "Multicast", "RFC 5771", true, false, false),
+	special("240.0.0.0/4", "Reserved", "RFC 1112", false, false, true),
+	special("255.255.255.255/32", "Limited Broadcast", "RFC 919", false, false, true),
+
+	special("::/128", "Unspecified Address", "RFC 4291", false, false, true),
+	special("::1/128", "Loopback Address", "RFC 4291", false, false, true),
+	special("::ffff:0:0/96", "IPv4-mapped Address", "RFC 4291", false, false, true),
+	special("64:ff9b::/96", "IPv4-IPv6 Translation", "RFC 6052", true, true, false),
+	special("64:ff9b:1::/48", "IPv4-IPv6 Translation", "RFC 8215", true, false, false),
+	special("100::/64", "Discard-Only Address Block", "RFC 6666", true, false, false),
+	special("100:0:0:1::/64", "Dummy IPv6 Prefix", "RFC 9780", false, false, false),
+	special("2001::/23", "IETF Protocol Assignments", "RFC 2928", false, false, false),
+	special("2001::/32", "TEREDO", "RFC 4380", true, false, false),
+	special("2001:1::1/128", "Port Control Protocol Anycast", "RFC 7723", true, true, false),
+	special("2001:1::2/128", "Traversal Using Relays around NAT Anycast", "RFC 8155", true, true, false),
+	special("2001:1::3/128", "DNS-SD Service Registration Protocol Anycast", "RFC 9665", true, true, false),
+	special("2001:2::/48", "Benchmarking", "RFC 5180", true, false, false),
+	special("2001:3::/32", "AMT", "RFC 7450", true, true, false),
+	special("2001:4:112::/48", "AS112-v6", "RFC 7535", true, true, false),
+	special("2001:20::/28", "ORCHIDv2", "RFC 7343", true, true, false),
+	special("2001:30::/28", "Drone Remote ID Protocol Entity Tags (DETs) Prefix", "RFC 9374", true, true, false),
+	special("2001:db8::/32", "Documentation", "RFC 3849", false, false, false),
+	special("2002::/16", "6to4", "RFC 3056", true, false, false),
+	special("2620:4f:8000::/48", "Direct Delegation AS112 Service", "RFC 7534", true, true, false),
+	special("3fff::/20", "Documentation", "RFC 9637", false, false, false),
+	special("5f00::/16", "Segment Routing (SRv6) SIDs", "RFC 9602", true, false, false),
+	special("fc00::/7", "Unique-Local", "RFC 4193", true, false, false),
+	special("fe80::/10", "Link-Local Unicast", "RFC 4291", false, false, true),
+	special("ff00::/8", "Multicast", "RFC 4291", true, false, false),
+}
+
+// classifyAddress looks ip up in the special-purpose registries. Addresses without
+// an entry are reported as global, forwardable and not reserved.
+func classifyAddress(ip netip.Addr) *AddressClass {
+	class := AddressClass{Version: 4, Global: true, Forwardable: true}
+	if ip.Is6() {
+		class.Version = 6
+	}
+
+	// Entries may be nested, e.g. 192.0.0.9/32 within 192.0.0.0/24, so the most
+	// specific one wins.
+	var match *specialPurpose
+
+	for i, entry := range specialPurposeRegistry {
+		if entry.block.Contains(ip) && (match == nil || entry.block.Bits() > match.block.Bits()) {
+			match = &specialPurposeRegistry[i]
+		}
+	}
+
+	if match != nil {
+		class.Block = stringPtr(match.block.String())
+		class.Name = stringPtr(match.name)
+		class.Reference = stringPtr(match.reference)
+		class.Global = match.global
+		class.Forwardable = match.forwardable
+		class.Reserved = match.reserved
+	}
+
+	return &class
+}
@@ -0,0 +1,40 @@
+package clientinfo
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyAddress(t *testing.T) {
+	tests := []struct {
+		ip                            string
+		version                       int
+		block, name                   string
+		global, forwardable, reserved bool
+	}{
+		{"8.8.8.8", 4, "", "", true, true, false},
+		{"10.1.2.3", 4, "10.0.0.0/8", "Private-Use", false, true, false},
+		{"100.100.0.1", 4, "100.64.0.0/10", "Shared Address Space", false, true, false},
+		{"127.0.0.1", 4, "127.0.0.0/8", "Loopback", false, false, true},
+		{"169.254.1.1", 4, "169.254.0.0/16", "Link Local", false, false, true},
+		{"192.0.0.9", 4, "192.0.0.9/32", "Port Control Protocol Anycast", true, true, false},
+		{"192.0.0.100", 4, "192.0.0.0/24", "IETF Protocol Assignments", false, false, false},
+		{"198.19.0.1", 4, "198.18.0.0/15", "Benchmarking", false, true, false},
+		{"239.255.255.250", 4, "224.0.0.0/4", "Multicast", false, true, false},
+		{"2a00:1450::1", 6, "", "", true, true, false},
+		{"::1", 6, "::1/128", "Loopback Address", false, false, true},
+		{"2001:db8::1", 6, "2001:db8::/32", "Documentation", false, false, false},
+		{"2001::1", 6, "2001::/32", "TEREDO", false, true, false},
+		{"fd00::1", 6, "fc00::/7", "Unique-Local", false, true, false},
+		{"fe80::1", 6, "fe80::/10", "Link-Local Unicast", false, false, true},
+		{"::ffff:10.0.0.1", 6, "::ffff:0.0.0.0/96", "IPv4-mapped Address", false, false, true},
+	}
+
+	for _, tt := range tests {
+		got := classifyAddress(netip.MustParseAddr(tt.ip))
+		if got.Version != tt.version || deref(got.Block) != tt.block || deref(got.Name) != tt.name ||
+			got.Global != tt.global || got.Forwardable != tt.forwardable || got.Reserved != tt.reserved {
+			t.Errorf("classifyAddress(%s) = %+v", tt.ip, got)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package clientinfo
+
+import (
+	"net/netip"
+
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb"
+)
+
+func buildASNInfo(ip netip.Addr, db *ipdb.ASNDB) *ASNInfo {
+	asn, ok := db.Lookup(ip)
+	if !ok {
+		return nil
+	}
+
+	info := ASNInfo{
+		Number:       asn.Number,
+		Organization: stringPtr(asn.Organization),
+	}
+
+	if asn.Prefix.IsValid() {
+		info.Prefix = stringPtr(asn.Prefix.String())
+	}
+
+	return &info
+}
@@ -0,0 +1,135 @@
+package clientinfo
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+// certVerification is the outcome of verifying a client certificate chain against the
+// configured CA bundle when the TLS stack itself was not asked to verify it.
+type certVerification struct {
+	err error
+}
+
+// RecordClientCertVerification stores the result of verifying the client certificate
+// presented on the connection the context belongs to.
+func RecordClientCertVerification(ctx context.Context, err error) {
+	state := connStateFrom(ctx)
+	if state == nil {
+		return
+	}
+
+	state.mu.Lock()
+	state.verification = &certVerification{err: err}
+	state.mu.Unlock()
+}
+
+func certVerificationFrom(ctx context.Context) *certVerification {
+	state := connStateFrom(ctx)
+	if state == nil {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.verification
+}
+
+func buildClientCertificateInfo(r *http.Request, cfg config.ProxyConfig, src Sources) *ClientCertificateInfo {
+	if r.TLS == nil {
+		if cfg.TLSHeaders.ClientCert != "" && proxyTrusted(r, cfg, src) {
+			return buildUpstreamClientCertificateInfo(r, cfg.TLSHeaders)
+		}
+
+		return nil
+	}
+
+	if len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	info := ClientCertificateInfo{
+		Source: stringPtr(tlsSourceDirect),
+		Chain:  make([]CertificateInfo, 0, len(r.TLS.PeerCertificates)),
+	}
+
+	for _, cert := range r.TLS.PeerCertificates {
+		info.Chain = append(info.Chain, describeCertificate(cert))
+	}
+
+	switch verification := certVerificationFrom(r.Context()); {
+	case len(r.TLS.VerifiedChains) > 0:
+		info.Verified = boolPtr(true)
+	case verification != nil:
+		info.Verified = boolPtr(verification.err == nil)
+		if verification.err != nil {
+			info.VerificationError = stringPtr(verification.err.Error())
+		}
+	}
+
+	return &info
+}
+
+func describeCertificate(cert *x509.Certificate) CertificateInfo {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	return CertificateInfo{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SANs:              subjectAltNames(cert),
+		SerialNumber:      hex.EncodeToString(cert.SerialNumber.Bytes()),
+		NotBefore:         cert.NotBefore.UTC(),
+		NotAfter:          cert.NotAfter.UTC(),
+		KeyType:           publicKeyType(cert),
+		SHA256Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.EmailAddresses)+len(cert.URIs))
+
+	for _, name := range cert.DNSNames {
+		names = append(names, "DNS:"+name)
+	}
+
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "IP:"+ip.String())
+	}
+
+	for _, email := range cert.EmailAddresses {
+		names = append(names, "email:"+email)
+	}
+
+	for _, uri := range cert.URIs {
+		names = append(names, "URI:"+uri.String())
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	return names
+}
+
+func publicKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
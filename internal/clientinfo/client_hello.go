@@ -0,0 +1,395 @@
+package clientinfo
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // JA3 is defined as an MD5 digest.
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	extensionServerName        uint16 = 0x0000
+	extensionALPN              uint16 = 0x0010
+	extensionSupportedVersions uint16 = 0x002b
+
+	ja4HashLength = 12
+	ja4MaxCount   = 99
+)
+
+// servedCertificate records what was stapled to the certificate sent to the client.
+type servedCertificate struct {
+	ocspStapled bool
+	sctStapled  bool
+}
+
+type clientHelloSnapshot struct {
+	info    ClientHello
+	ja3     string
+	ja3Hash string
+	ja4     string
+}
+
+// RecordClientHello stores the ClientHello of a handshake in progress. It is meant
+// to be called from tls.Config.GetConfigForClient.
+func RecordClientHello(hello *tls.ClientHelloInfo) {
+	if hello == nil {
+		return
+	}
+
+	state := connStateFrom(hello.Context())
+	if state == nil {
+		return
+	}
+
+	// QUIC handshakes either carry no Conn or one that stands in for the UDP socket.
+	transport := byte('t')
+	if hello.Conn == nil || hello.Conn.LocalAddr().Network() == "udp" {
+		transport = 'q'
+	}
+
+	snapshot := fingerprintClientHello(hello, transport)
+
+	state.mu.Lock()
+	state.hello = snapshot
+	state.mu.Unlock()
+}
+
+// RecordServedCertificate stores the stapling state of the certificate chosen for a
+// handshake in progress. It is meant to be called from tls.Config.GetCertificate.
+func RecordServedCertificate(hello *tls.ClientHelloInfo, cert *tls.Certificate) {
+	if hello == nil || cert == nil {
+		return
+	}
+
+	state := connStateFrom(hello.Context())
+	if state == nil {
+		return
+	}
+
+	served := &servedCertificate{
+		ocspStapled: len(cert.OCSPStaple) > 0,
+		sctStapled:  len(cert.SignedCertificateTimestamps) > 0,
+	}
+
+	state.mu.Lock()
+	state.served = served
+	state.mu.Unlock()
+}
+
+func clientHelloFrom(ctx context.Context) *clientHelloSnapshot {
+	state := connStateFrom(ctx)
+	if state == nil {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.hello
+}
+
+func servedCertificateFrom(ctx context.Context) *servedCertificate {
+	state := connStateFrom(ctx)
+	if state == nil {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.served
+}
+
+// fingerprintClientHello describes the ClientHello and computes its JA3 and JA4 fingerprints.
+// The transport is 't' for TCP and 'q' for QUIC, as used by the JA4 prefix.
+func fingerprintClientHello(hello *tls.ClientHelloInfo, transport byte) *clientHelloSnapshot {
+	info := ClientHello{
+		ServerName: stringPtr(hello.ServerName),
+		ALPN:       slices.Clone(hello.SupportedProtos),
+	}
+
+	for _, version := range hello.SupportedVersions {
+		info.Versions = append(info.Versions, tlsValueName(version, tls.VersionName(version)))
+	}
+
+	for _, suite := range hello.CipherSuites {
+		info.CipherSuites = append(info.CipherSuites, tlsValueName(suite, tls.CipherSuiteName(suite)))
+	}
+
+	for _, ext := range hello.Extensions {
+		info.Extensions = append(info.Extensions, tlsValueName(ext, extensionName(ext)))
+	}
+
+	for _, curve := range hello.SupportedCurves {
+		info.Curves = append(info.Curves, tlsValueName(uint16(curve), curve.String()))
+	}
+
+	for _, point := range hello.SupportedPoints {
+		info.PointFormats = append(info.PointFormats, pointFormatName(point))
+	}
+
+	for _, scheme := range hello.SignatureSchemes {
+		info.SignatureSchemes = append(info.SignatureSchemes, tlsValueName(uint16(scheme), scheme.String()))
+	}
+
+	ja3 := ja3String(hello)
+	sum := md5.Sum([]byte(ja3)) //nolint:gosec // JA3 is defined as an MD5 digest.
+
+	return &clientHelloSnapshot{
+		info:    info,
+		ja3:     ja3,
+		ja3Hash: hex.EncodeToString(sum[:]),
+		ja4:     ja4String(hello, transport),
+	}
+}
+
+func tlsValueName(value uint16, name string) string {
+	if isGREASE(value) {
+		return fmt.Sprintf("GREASE (0x%04x)", value)
+	}
+
+	return name
+}
+
+// extensionNames maps registered TLS extension IDs to their IANA names.
+var extensionNames = map[uint16]string{
+	0:     "server_name",
+	1:     "max_fragment_length",
+	5:     "status_request",
+	10:    "supported_groups",
+	11:    "ec_point_formats",
+	13:    "signature_algorithms",
+	14:    "use_srtp",
+	15:    "heartbeat",
+	16:    "application_layer_protocol_negotiation",
+	17:    "status_request_v2",
+	18:    "signed_certificate_timestamp",
+	21:    "padding",
+	22:    "encrypt_then_mac",
+	23:    "extended_master_secret",
+	27:    "compress_certificate",
+	28:    "record_size_limit",
+	34:    "delegated_credential",
+	35:    "session_ticket",
+	41:    "pre_shared_key",
+	42:    "early_data",
+	43:    "supported_versions",
+	44:    "cookie",
+	45:    "psk_key_exchange_modes",
+	47:    "certificate_authorities",
+	48:    "oid_filters",
+	49:    "post_handshake_auth",
+	50:    "signature_algorithms_cert",
+	51:    "key_share",
+	57:    "quic_transport_parameters",
+	17513: "application_settings_old",
+	17613: "application_settings",
+	65037: "encrypted_client_hello",
+	65281: "renegotiation_info",
+}
+
+func extensionName(ext uint16) string {
+	if name, ok := extensionNames[ext]; ok {
+		return fmt.Sprintf("%s (%d)", name, ext)
+	}
+
+	return fmt.Sprintf("unknown (%d)", ext)
+}
+
+func pointFormatName(format uint8) string {
+	switch format {
+	case 0:
+		return "uncompressed"
+	case 1:
+		return "ansiX962_compressed_prime"
+	case 2: //nolint:mnd // IANA EC point format identifier.
+		return "ansiX962_compressed_char2"
+	default:
+		return fmt.Sprintf("unknown (%d)", format)
+	}
+}
+
+// ja3String builds the JA3 fingerprint: version, ciphers, extensions, curves and point formats.
+func ja3String(hello *tls.ClientHelloInfo) string {
+	curves := make([]uint16, 0, len(hello.SupportedCurves))
+	for _, curve := range hello.SupportedCurves {
+		curves = append(curves, uint16(curve))
+	}
+
+	points := make([]string, 0, len(hello.SupportedPoints))
+	for _, point := range hello.SupportedPoints {
+		points = append(points, strconv.Itoa(int(point)))
+	}
+
+	return strings.Join([]string{
+		strconv.Itoa(int(legacyVersion(hello))),
+		joinDecimal(hello.CipherSuites),
+		joinDecimal(hello.Extensions),
+		joinDecimal(curves),
+		strings.Join(points, "-"),
+	}, ",")
+}
+
+// legacyVersion recovers the ClientHello legacy_version field. Clients offering the
+// supported_versions extension must send TLS 1.2 there; otherwise crypto/tls derives
+// SupportedVersions from it, so its maximum is the advertised version.
+func legacyVersion(hello *tls.ClientHelloInfo) uint16 {
+	if slices.Contains(hello.Extensions, extensionSupportedVersions) {
+		return tls.VersionTLS12
+	}
+
+	var version uint16
+
+	for _, v := range hello.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+
+	return version
+}
+
+// ja4String builds the JA4 fingerprint as specified by FoxIO.
+func ja4String(hello *tls.ClientHelloInfo, transport byte) string {
+	ciphers := withoutGREASE(hello.CipherSuites)
+	extensions := withoutGREASE(hello.Extensions)
+
+	sni := "i"
+	if hello.ServerName != "" {
+		sni = "d"
+	}
+
+	prefix := fmt.Sprintf("%c%s%s%02d%02d%s",
+		transport,
+		ja4Version(hello.SupportedVersions),
+		sni,
+		min(len(ciphers), ja4MaxCount),
+		min(len(extensions), ja4MaxCount),
+		ja4ALPN(hello.SupportedProtos),
+	)
+
+	slices.Sort(ciphers)
+
+	sortedExtensions := make([]uint16, 0, len(extensions))
+	for _, ext := range extensions {
+		if ext != extensionServerName && ext != extensionALPN {
+			sortedExtensions = append(sortedExtensions, ext)
+		}
+	}
+
+	slices.Sort(sortedExtensions)
+
+	extensionPart := joinHex(sortedExtensions)
+
+	schemes := make([]uint16, 0, len(hello.SignatureSchemes))
+	for _, scheme := range hello.SignatureSchemes {
+		schemes = append(schemes, uint16(scheme))
+	}
+
+	if schemes = withoutGREASE(schemes); len(schemes) > 0 {
+		extensionPart += "_" + joinHex(schemes)
+	}
+
+	cipherHash := ja4Hash(joinHex(ciphers), len(ciphers) == 0)
+	extensionHash := ja4Hash(extensionPart, len(sortedExtensions) == 0)
+
+	return prefix + "_" + cipherHash + "_" + extensionHash
+}
+
+func ja4Version(versions []uint16) string {
+	var highest uint16
+
+	for _, v := range versions {
+		if !isGREASE(v) && v > highest {
+			highest = v
+		}
+	}
+
+	switch highest {
+	case tls.VersionTLS13:
+		return "13"
+	case tls.VersionTLS12:
+		return "12"
+	case tls.VersionTLS11:
+		return "11"
+	case tls.VersionTLS10:
+		return "10"
+	case tls.VersionSSL30: //nolint:staticcheck // SSLv3 still has a JA4 code.
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+func ja4ALPN(protos []string) string {
+	if len(protos) == 0 || protos[0] == "" {
+		return "00"
+	}
+
+	value := protos[0]
+	first, last := value[0], value[len(value)-1]
+
+	if isAlphanumeric(first) && isAlphanumeric(last) {
+		return string([]byte{first, last})
+	}
+
+	encoded := hex.EncodeToString([]byte(value))
+
+	return string([]byte{encoded[0], encoded[len(encoded)-1]})
+}
+
+func ja4Hash(value string, empty bool) string {
+	if empty {
+		return strings.Repeat("0", ja4HashLength)
+	}
+
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:])[:ja4HashLength]
+}
+
+// isGREASE reports whether the value is one of the reserved GREASE values (RFC 8701).
+func isGREASE(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	filtered := make([]uint16, 0, len(values))
+
+	for _, v := range values {
+		if !isGREASE(v) {
+			filtered = append(filtered, v)
+		}
+	}
+
+	return filtered
+}
+
+func joinDecimal(values []uint16) string {
+	parts := make([]string, 0, len(values))
+
+	for _, v := range withoutGREASE(values) {
+		parts = append(parts, strconv.Itoa(int(v)))
+	}
+
+	return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, 0, len(values))
+
+	for _, v := range values {
+		parts = append(parts, fmt.Sprintf("%04x", v))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,84 @@
+package clientinfo
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestJA3(t *testing.T) {
+	// Reference vector from the JA3 README.
+	hello := &tls.ClientHelloInfo{
+		CipherSuites:      []uint16{47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+		Extensions:        []uint16{0, 10, 11},
+		SupportedCurves:   []tls.CurveID{23, 24, 25},
+		SupportedPoints:   []uint8{0},
+		SupportedVersions: []uint16{tls.VersionTLS10},
+	}
+
+	snapshot := fingerprintClientHello(hello, 't')
+
+	if want := "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0"; snapshot.ja3 != want {
+		t.Fatalf("unexpected JA3 string: %s", snapshot.ja3)
+	}
+
+	if want := "ada70206e40642a3e4461f35503241d5"; snapshot.ja3Hash != want {
+		t.Fatalf("unexpected JA3 hash: %s", snapshot.ja3Hash)
+	}
+}
+
+func TestJA4(t *testing.T) {
+	// Reference vector from the JA4 technical details, with GREASE values mixed in.
+	hello := &tls.ClientHelloInfo{
+		ServerName: "example.com",
+		CipherSuites: []uint16{
+			0x0a0a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+			0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+		},
+		Extensions: []uint16{
+			0x1a1a, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010, 0x0005,
+			0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x4469, 0x0015,
+		},
+		SignatureSchemes:  []tls.SignatureScheme{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+		SupportedProtos:   []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x2a2a, tls.VersionTLS13, tls.VersionTLS12},
+		SupportedCurves:   []tls.CurveID{0x2a2a, tls.X25519, tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+	}
+
+	snapshot := fingerprintClientHello(hello, 't')
+
+	if want := "t13d1516h2_8daaf6152771_e5627efa2ab1"; snapshot.ja4 != want {
+		t.Fatalf("unexpected JA4: %s", snapshot.ja4)
+	}
+
+	if got := snapshot.info.CipherSuites[0]; got != "GREASE (0x0a0a)" {
+		t.Fatalf("expected GREASE cipher to be labeled, got %s", got)
+	}
+
+	if got := snapshot.info.Extensions[1]; got != "server_name (0)" {
+		t.Fatalf("unexpected extension name: %s", got)
+	}
+
+	if want := "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53," +
+		"0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21,29-23,0"; snapshot.ja3 != want {
+		t.Fatalf("unexpected JA3 string: %s", snapshot.ja3)
+	}
+}
+
+func TestJA4ALPN(t *testing.T) {
+	tests := []struct {
+		protos []string
+		want   string
+	}{
+		{nil, "00"},
+		{[]string{"http/1.1"}, "h1"},
+		{[]string{"h3"}, "h3"},
+		{[]string{"\xabcd"}, "a4"},
+	}
+
+	for _, tt := range tests {
+		if got := ja4ALPN(tt.protos); got != tt.want {
+			t.Fatalf("ja4ALPN(%q) = %s, want %s", tt.protos, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package clientinfo
+
+import (
+	"context"
+	"sync"
+)
+
+type connStateKey struct{}
+
+// connState holds per-connection details that are only observable during the handshake
+// or from the transport itself rather than from individual requests.
+type connState struct {
+	mu           sync.Mutex
+	hello        *clientHelloSnapshot
+	served       *servedCertificate
+	verification *certVerification
+	quic         func() QUICInfo
+}
+
+// NewConnContext attaches per-connection state to a connection context so that
+// handshake details can later be reported for requests served over it.
+func NewConnContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, connStateKey{}, &connState{})
+}
+
+func connStateFrom(ctx context.Context) *connState {
+	if ctx == nil {
+		return nil
+	}
+
+	state, _ := ctx.Value(connStateKey{}).(*connState)
+
+	return state
+}
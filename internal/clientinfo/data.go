@@ -3,45 +3,190 @@ package clientinfo
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"time"
 
 	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb"
+	"git.skobk.in/skobkin/ip-detect/internal/subnets"
 )
 
 // Data describes resolved request metadata that can be rendered or serialized.
 type Data struct {
-	IPAddress         string             `json:"ip_address"`
-	Locale            *string            `json:"locale"`
-	PreferredLanguage *string            `json:"preferred_language"`
-	Hostname          *string            `json:"hostname"`
-	UserAgent         *string            `json:"user_agent"`
-	Method            string             `json:"method"`
-	Path              string             `json:"path"`
-	Timestamp         *time.Time         `json:"timestamp"`
-	Connection        *ConnectionInfo    `json:"connection"`
-	TLS               *TLSInfo           `json:"tls"`
-	Proxy             *ProxyInfo         `json:"proxy"`
-	Preferences       *ClientPreferences `json:"client_preferences"`
-	OriginContext     *OriginContext     `json:"origin_context"`
-	ClientHints       *ClientHints       `json:"ua_client_hints"`
-	RequestHeaders    []HeaderEntry      `json:"request_headers"`
-}
-
-// ConnectionInfo describes the transport-level details of the request.
+	IPAddress         string                 `json:"ip_address"`
+	AddressClass      *AddressClass          `json:"address_class"`
+	IPv6              *IPv6Info              `json:"ipv6"`
+	Locale            *string                `json:"locale"`
+	PreferredLanguage *string                `json:"preferred_language"`
+	Hostname          *string                `json:"hostname"`
+	ReverseDNS        *ReverseDNSInfo        `json:"reverse_dns"`
+	Geo               *GeoInfo               `json:"geo"`
+	ASN               *ASNInfo               `json:"asn"`
+	UserAgent         *string                `json:"user_agent"`
+	Method            string                 `json:"method"`
+	Path              string                 `json:"path"`
+	Timestamp         *time.Time             `json:"timestamp"`
+	Connection        *ConnectionInfo        `json:"connection"`
+	TLS               *TLSInfo               `json:"tls"`
+	ClientCertificate *ClientCertificateInfo `json:"client_certificate"`
+	Proxy             *ProxyInfo             `json:"proxy"`
+	Preferences       *ClientPreferences     `json:"client_preferences"`
+	OriginContext     *OriginContext         `json:"origin_context"`
+	ClientHints       *ClientHints           `json:"ua_client_hints"`
+	RequestHeaders    []HeaderEntry          `json:"request_headers"`
+}
+
+// ReverseDNSInfo lists the PTR names of the client IP. A name is forward-confirmed
+// when it resolves back to the client IP; other names may be spoofed by whoever
+// controls the reverse zone. Forward is "confirmed", "mismatch" when the name
+// resolves to other addresses only, or "lookup_failed" when it could not be
+// resolved in time. Unicode is the display form of internationalized names.
+type ReverseDNSInfo struct {
+	Names []PTRName `json:"names"`
+}
+
+// PTRName is a single PTR record of the client IP.
+type PTRName struct {
+	Name    string  `json:"name"`
+	Unicode *string `json:"unicode"`
+	Forward string  `json:"forward"`
+}
+
+// AddressClass describes what kind of address the client IP is. Block, Name and
+// Reference identify its entry in the IANA special-purpose address registries and
+// are empty for ordinary unicast addresses; the flags follow the registry columns.
+type AddressClass struct {
+	Version     int     `json:"version"`
+	Block       *string `json:"block"`
+	Name        *string `json:"name"`
+	Reference   *string `json:"reference"`
+	Global      bool    `json:"global"`
+	Forwardable bool    `json:"forwardable"`
+	Reserved    bool    `json:"reserved"`
+}
+
+// IPv6Info describes what an IPv6 client address reveals. Mechanism names the
+// transition mechanism the address belongs to, if any, and EmbeddedIPv4 the IPv4
+// address it carries. The interface identifier is the lower 64 bits; its type is
+// "eui-64" (derived from MACAddress), "isatap", "low-byte" or "randomized".
+type IPv6Info struct {
+	Mechanism       *string     `json:"mechanism"`
+	EmbeddedIPv4    *string     `json:"embedded_ipv4"`
+	Teredo          *TeredoInfo `json:"teredo"`
+	InterfaceID     *string     `json:"interface_id"`
+	InterfaceIDType *string     `json:"interface_id_type"`
+	MACAddress      *string     `json:"mac_address"`
+	Vendor          *string     `json:"vendor"`
+	// LikelyPrivacy is set for randomized identifiers, which are most likely
+	// temporary or stable privacy addresses.
+	LikelyPrivacy bool `json:"likely_privacy"`
+}
+
+// TeredoInfo is decoded from a Teredo address: the Teredo server and the public
+// address and port of the client's NAT.
+type TeredoInfo struct {
+	Server     string `json:"server"`
+	ClientIP   string `json:"client_ip"`
+	ClientPort int    `json:"client_port"`
+}
+
+// GeoInfo is the location of the client IP according to the GeoIP database.
+type GeoInfo struct {
+	CountryCode    *string  `json:"country_code"`
+	Country        *string  `json:"country"`
+	RegionCode     *string  `json:"region_code"`
+	Region         *string  `json:"region"`
+	City           *string  `json:"city"`
+	PostalCode     *string  `json:"postal_code"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	AccuracyRadius *int     `json:"accuracy_radius_km"`
+	TimeZone       *string  `json:"time_zone"`
+}
+
+// ASNInfo is the autonomous system announcing the client IP according to the ASN
+// database.
+type ASNInfo struct {
+	Number       uint32  `json:"number"`
+	Organization *string `json:"organization"`
+	Prefix       *string `json:"prefix"`
+}
+
+// ConnectionInfo describes the transport-level details of the request. The source
+// fields are "connection" when a value was taken from the request itself and name the
+// header otherwise, which is only consulted when sent by a trusted proxy.
 type ConnectionInfo struct {
-	Scheme     *string `json:"scheme"`
-	Protocol   *string `json:"protocol"`
-	Host       *string `json:"host"`
-	RemoteAddr *string `json:"remote_addr"`
+	Scheme       *string   `json:"scheme"`
+	SchemeSource *string   `json:"scheme_source"`
+	Protocol     *string   `json:"protocol"`
+	Host         *string   `json:"host"`
+	HostSource   *string   `json:"host_source"`
+	Port         *string   `json:"port"`
+	PortSource   *string   `json:"port_source"`
+	RemoteAddr   *string   `json:"remote_addr"`
+	QUIC         *QUICInfo `json:"quic"`
+}
+
+// QUICInfo describes the QUIC connection an HTTP/3 request was served over.
+type QUICInfo struct {
+	Version  *string `json:"version"`
+	Used0RTT *bool   `json:"used_0rtt"`
+	Migrated *bool   `json:"migrated"`
 }
 
 // TLSInfo summarizes TLS session details when the request is served over HTTPS.
+// Source is "direct" when the server terminated TLS itself and "upstream" when the
+// details were taken from headers set by a trusted TLS-terminating proxy.
 type TLSInfo struct {
-	Version            *string `json:"version"`
-	CipherSuite        *string `json:"cipher_suite"`
-	ServerName         *string `json:"server_name"`
-	NegotiatedProtocol *string `json:"negotiated_protocol"`
+	Source             *string      `json:"source"`
+	Version            *string      `json:"version"`
+	CipherSuite        *string      `json:"cipher_suite"`
+	ServerName         *string      `json:"server_name"`
+	NegotiatedProtocol *string      `json:"negotiated_protocol"`
+	KeyExchange        *string      `json:"key_exchange"`
+	Resumed            *bool        `json:"resumed"`
+	EarlyData          *bool        `json:"early_data"`
+	ECHAccepted        *bool        `json:"ech_accepted"`
+	OCSPStapled        *bool        `json:"ocsp_stapled"`
+	SCTStapled         *bool        `json:"sct_stapled"`
+	ClientHello        *ClientHello `json:"client_hello"`
+	JA3                *string      `json:"ja3"`
+	JA3Hash            *string      `json:"ja3_hash"`
+	JA4                *string      `json:"ja4"`
+}
+
+// ClientHello lists what the client offered in its TLS ClientHello, in the order it was sent.
+type ClientHello struct {
+	Versions         []string `json:"supported_versions"`
+	CipherSuites     []string `json:"cipher_suites"`
+	Extensions       []string `json:"extensions"`
+	Curves           []string `json:"supported_groups"`
+	PointFormats     []string `json:"point_formats"`
+	ALPN             []string `json:"alpn"`
+	SignatureSchemes []string `json:"signature_schemes"`
+	ServerName       *string  `json:"server_name"`
+}
+
+// ClientCertificateInfo describes the certificate chain presented by the client during mutual TLS.
+// Source has the same meaning as in TLSInfo.
+type ClientCertificateInfo struct {
+	Source            *string           `json:"source"`
+	Chain             []CertificateInfo `json:"chain"`
+	Verified          *bool             `json:"verified"`
+	VerificationError *string           `json:"verification_error"`
+}
+
+// CertificateInfo summarizes a single X.509 certificate.
+type CertificateInfo struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SANs              []string  `json:"sans"`
+	SerialNumber      string    `json:"serial_number"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	KeyType           string    `json:"key_type"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
 }
 
 // ProxyInfo captures common proxy-related headers as sent by the client/proxy.
@@ -94,26 +239,49 @@ type HeaderEntry struct {
 	Value string `json:"value"`
 }
 
+// Sources are the lists and databases read by Collect besides the configuration.
+// The server owns them and refreshes them while requests read them. Nil fields are
+// empty.
+type Sources struct {
+	// TrustedSubnets holds the prefixes read from the trusted subnet files.
+	TrustedSubnets *subnets.List
+	// ProviderSubnets holds the ranges of each client IP provider, keyed by its file.
+	ProviderSubnets map[string]*subnets.List
+	GeoIP           *ipdb.GeoDB
+	ASN             *ipdb.ASNDB
+}
+
 // Collect inspects the HTTP request and builds a Data snapshot.
-func Collect(ctx context.Context, r *http.Request, cfg config.Config) Data {
+func Collect(ctx context.Context, r *http.Request, cfg config.Config, src Sources) Data {
 	locale, preferred := ParseAcceptLanguage(r.Header.Get("Accept-Language"))
-	ipAddress := resolveClientIP(r, cfg.Proxy)
+	clientIP := resolveClientIP(r, cfg.Proxy, src)
 
 	data := Data{
-		IPAddress: ipAddress,
-		Method:    r.Method,
-		Path:      r.URL.Path,
+		Method: r.Method,
+		Path:   r.URL.Path,
+	}
+
+	var ipAddress string
+	if clientIP.IsValid() {
+		ipAddress = clientIP.String()
+		data.IPAddress = ipAddress
+		data.AddressClass = classifyAddress(clientIP)
+		data.IPv6 = buildIPv6Info(clientIP)
 	}
 
 	data.Locale = stringPtr(locale)
 	data.PreferredLanguage = stringPtr(preferred)
 
 	if cfg.Metadata.IncludeConnection {
-		data.Connection = buildConnectionInfo(r, ipAddress)
+		data.Connection = buildConnectionInfo(r, ipAddress, cfg.Proxy, src)
 	}
 
 	if cfg.Metadata.IncludeTLS {
-		data.TLS = buildTLSInfo(r)
+		data.TLS = buildTLSInfo(r, cfg.Proxy, src)
+	}
+
+	if cfg.Metadata.IncludeClientCertificate {
+		data.ClientCertificate = buildClientCertificateInfo(r, cfg.Proxy, src)
 	}
 
 	if cfg.Metadata.IncludeProxyDetails {
@@ -145,9 +313,18 @@ func Collect(ctx context.Context, r *http.Request, cfg config.Config) Data {
 		data.UserAgent = stringPtr(r.UserAgent())
 	}
 
-	if cfg.Resolver.EnableReverseDNS && ipAddress != "" {
-		if host := reverseLookup(ctx, ipAddress, cfg.Resolver.LookupTimeout); host != "" {
-			data.Hostname = stringPtr(host)
+	if src.GeoIP != nil {
+		data.Geo = buildGeoInfo(clientIP, src.GeoIP)
+	}
+
+	if src.ASN != nil {
+		data.ASN = buildASNInfo(clientIP, src.ASN)
+	}
+
+	if cfg.Resolver.EnableReverseDNS && clientIP.IsValid() {
+		if info := reverseLookup(ctx, net.DefaultResolver, clientIP, cfg.Resolver); info != nil {
+			data.ReverseDNS = info
+			data.Hostname = stringPtr(info.Names[0].Name)
 		}
 	}
 
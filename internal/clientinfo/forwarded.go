@@ -0,0 +1,149 @@
+package clientinfo
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// forwardedElement holds the parameters of one hop of a Forwarded header (RFC 7239),
+// keyed by lower-case name.
+type forwardedElement map[string]string
+
+// parseForwarded splits a Forwarded header into its elements. Values may be tokens
+// or quoted strings, which can contain "," and ";" as well as backslash escapes.
+// Parameters without a value and repeated parameters are ignored, as are empty
+// elements.
+func parseForwarded(value string) []forwardedElement {
+	var elements []forwardedElement
+
+	current := forwardedElement{}
+
+	for i := 0; i < len(value); {
+		switch value[i] {
+		case ' ', '\t', ';':
+			i++
+
+			continue
+		case ',':
+			if len(current) > 0 {
+				elements = append(elements, current)
+				current = forwardedElement{}
+			}
+
+			i++
+
+			continue
+		}
+
+		start := i
+		for i < len(value) && !strings.ContainsRune("=;,", rune(value[i])) {
+			i++
+		}
+
+		name := strings.ToLower(strings.TrimSpace(value[start:i]))
+		if i == len(value) || value[i] != '=' {
+			continue
+		}
+
+		i++
+
+		var param string
+		if i < len(value) && value[i] == '"' {
+			param, i = readQuotedString(value, i+1)
+		} else {
+			start = i
+			for i < len(value) && value[i] != ';' && value[i] != ',' {
+				i++
+			}
+
+			param = strings.TrimSpace(value[start:i])
+		}
+
+		if _, seen := current[name]; name != "" && !seen {
+			current[name] = param
+		}
+	}
+
+	if len(current) > 0 {
+		elements = append(elements, current)
+	}
+
+	return elements
+}
+
+// readQuotedString reads a quoted string starting after its opening quote and
+// returns the unescaped content and the position after the closing quote. An
+// unterminated string runs to the end of value.
+func readQuotedString(value string, i int) (string, int) {
+	var b strings.Builder
+
+	for ; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"':
+			return b.String(), i + 1
+		case '\\':
+			if i+1 < len(value) {
+				i++
+				b.WriteByte(value[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), i
+}
+
+// forwardedParam returns the first value of the parameter key in a Forwarded header.
+func forwardedParam(value, key string) string {
+	for _, element := range parseForwarded(value) {
+		if param := element[key]; param != "" {
+			return param
+		}
+	}
+
+	return ""
+}
+
+// forwardedFor returns the address of every for= node in a Forwarded header, in
+// header order. Nodes that are not addresses ("unknown" and obfuscated identifiers
+// such as "_hidden") and elements without for= yield an invalid address.
+func forwardedFor(value string) []netip.Addr {
+	elements := parseForwarded(value)
+	addrs := make([]netip.Addr, 0, len(elements))
+
+	for _, element := range elements {
+		addrs = append(addrs, parseForwardedNode(element["for"]))
+	}
+
+	return addrs
+}
+
+// parseForwardedNode parses a node such as 192.0.2.60, 192.0.2.60:8080 or
+// [2001:db8::1]:8080. A bare IPv6 address is accepted too, since some proxies
+// omit the brackets the RFC requires.
+func parseForwardedNode(node string) netip.Addr {
+	if rest, ok := strings.CutPrefix(node, "["); ok {
+		host, _, ok := strings.Cut(rest, "]")
+		if !ok {
+			return netip.Addr{}
+		}
+
+		if ip, err := netip.ParseAddr(host); err == nil && ip.Is6() && ip.Zone() == "" {
+			return ip
+		}
+
+		return netip.Addr{}
+	}
+
+	if ip, err := netip.ParseAddr(node); err == nil && ip.Zone() == "" {
+		return ip
+	}
+
+	host, _, _ := strings.Cut(node, ":")
+	if ip, err := netip.ParseAddr(host); err == nil && ip.Is4() {
+		return ip
+	}
+
+	return netip.Addr{}
+}
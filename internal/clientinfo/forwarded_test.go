@@ -0,0 +1,64 @@
+package clientinfo
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []forwardedElement
+	}{
+		{"for=192.0.2.60;proto=http;by=203.0.113.43", []forwardedElement{
+			{"for": "192.0.2.60", "proto": "http", "by": "203.0.113.43"},
+		}},
+		{`For="[2001:db8:cafe::17]:4711", for=198.51.100.17`, []forwardedElement{
+			{"for": "[2001:db8:cafe::17]:4711"},
+			{"for": "198.51.100.17"},
+		}},
+		{`for="_gazonk,\"x\";y", ,for=unknown;for=192.0.2.1`, []forwardedElement{
+			{"for": `_gazonk,"x";y`},
+			{"for": "unknown"},
+		}},
+		{"proto; for=192.0.2.1", []forwardedElement{{"for": "192.0.2.1"}}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := parseForwarded(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("parseForwarded(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestParseForwardedNode(t *testing.T) {
+	tests := []struct {
+		node string
+		want string
+	}{
+		{"192.0.2.60", "192.0.2.60"},
+		{"192.0.2.60:8080", "192.0.2.60"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:_port", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[192.0.2.60]", ""},
+		{"[2001:db8::1", ""},
+		{"unknown", ""},
+		{"_hidden", ""},
+		{"_hidden:443", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		var want netip.Addr
+		if tt.want != "" {
+			want = netip.MustParseAddr(tt.want)
+		}
+
+		if got := parseForwardedNode(tt.node); got != want {
+			t.Fatalf("parseForwardedNode(%q) = %v, want %v", tt.node, got, want)
+		}
+	}
+}
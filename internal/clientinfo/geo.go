@@ -0,0 +1,40 @@
+package clientinfo
+
+import (
+	"net/netip"
+
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb"
+)
+
+func buildGeoInfo(ip netip.Addr, db *ipdb.GeoDB) *GeoInfo {
+	location, ok := db.Lookup(ip)
+	if !ok {
+		return nil
+	}
+
+	info := GeoInfo{
+		CountryCode: stringPtr(location.CountryCode),
+		Country:     stringPtr(location.Country),
+		RegionCode:  stringPtr(location.RegionCode),
+		Region:      stringPtr(location.Region),
+		City:        stringPtr(location.City),
+		PostalCode:  stringPtr(location.PostalCode),
+		TimeZone:    stringPtr(location.TimeZone),
+	}
+
+	if location.HasCoordinates {
+		info.Latitude = &location.Latitude
+		info.Longitude = &location.Longitude
+
+		if location.AccuracyRadius > 0 {
+			radius := int(location.AccuracyRadius)
+			info.AccuracyRadius = &radius
+		}
+	}
+
+	if !hasPtr(info.CountryCode, info.Country, info.City, info.TimeZone) && info.Latitude == nil {
+		return nil
+	}
+
+	return &info
+}
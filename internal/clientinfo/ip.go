@@ -9,26 +9,149 @@ import (
 	"git.skobk.in/skobkin/ip-detect/internal/config"
 )
 
-func resolveClientIP(r *http.Request, cfg config.ProxyConfig) string {
-	remoteIP, _ := parseRemoteAddr(r.RemoteAddr)
+func resolveClientIP(r *http.Request, cfg config.ProxyConfig, src Sources) netip.Addr {
+	peer := peerIP(r, cfg, src)
+
+	if ip := providerClientIP(r, peer, cfg, src); ip.IsValid() {
+		return ip
+	}
+
+	return peer
+}
 
-	if cfg.TrustForwarded {
-		if len(cfg.TrustedSubnets) == 0 || (remoteIP.IsValid() && ipAllowed(remoteIP, cfg.TrustedSubnets)) {
-			if ip := firstForwardedIP(r.Header.Get("X-Forwarded-For")); ip.IsValid() {
-				return ip.String()
+// peerIP returns the address the request reached the trusted network from: the
+// remote address, or the address taken from client IP headers set by a trusted proxy.
+func peerIP(r *http.Request, cfg config.ProxyConfig, src Sources) netip.Addr {
+	if proxyTrusted(r, cfg, src) {
+		for _, header := range cfg.ClientIPHeaders {
+			if ip := headerClientIP(r, header, cfg, src); ip.IsValid() {
+				return ip
 			}
+		}
+	}
+
+	remoteIP, _ := parseRemoteAddr(r.RemoteAddr)
+
+	return remoteIP
+}
+
+// providerClientIP returns the client IP set by a CDN or proxy provider when peer is
+// in its ranges. Providers do not depend on TrustForwarded, as configuring one is
+// trust enough.
+func providerClientIP(r *http.Request, peer netip.Addr, cfg config.ProxyConfig, src Sources) netip.Addr {
+	if !peer.IsValid() {
+		return netip.Addr{}
+	}
+
+	for _, provider := range cfg.Providers() {
+		if !src.ProviderSubnets[provider.File].Contains(peer) {
+			continue
+		}
+
+		var ip netip.Addr
+		if provider.Hops > 0 {
+			ip = hopClientIP(forwardedForChain(headerValue(r, provider.Header)), provider.Hops)
+		} else {
+			ip, _ = parseIP(r.Header.Get(provider.Header))
+		}
+
+		if ip.IsValid() {
+			return ip
+		}
+	}
+
+	return netip.Addr{}
+}
+
+// headerClientIP returns the client IP carried by one of the supported headers, or an
+// invalid address when the header is absent or holds no usable address.
+func headerClientIP(r *http.Request, header string, cfg config.ProxyConfig, src Sources) netip.Addr {
+	switch header {
+	case config.HeaderForwarded:
+		return chainClientIP(forwardedFor(headerValue(r, header)), cfg, src)
+	case config.HeaderXForwardedFor:
+		return chainClientIP(forwardedForChain(headerValue(r, header)), cfg, src)
+	case config.HeaderXRealIP:
+		if ip, ok := parseIP(r.Header.Get(header)); ok {
+			return ip
+		}
+	}
+
+	return netip.Addr{}
+}
+
+// proxyTrusted reports whether headers set by a reverse proxy may be honored for the request.
+func proxyTrusted(r *http.Request, cfg config.ProxyConfig, src Sources) bool {
+	if !cfg.TrustForwarded {
+		return false
+	}
+
+	if !cfg.SubnetsRestricted() {
+		return true
+	}
+
+	// Unix socket peers have no address to check against the subnets.
+	if unixSocketRequest(r) {
+		return cfg.TrustUnixSockets
+	}
 
-			if ip, ok := parseIP(r.Header.Get("X-Real-IP")); ok {
-				return ip.String()
+	remoteIP, ok := parseRemoteAddr(r.RemoteAddr)
+	if !ok {
+		return false
+	}
+
+	return trustedProxy(remoteIP, cfg, src)
+}
+
+// unixSocketRequest reports whether the request arrived on a Unix socket listener.
+func unixSocketRequest(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+
+	return ok
+}
+
+// trustedProxy reports whether ip belongs to the trusted proxy subnets.
+func trustedProxy(ip netip.Addr, cfg config.ProxyConfig, src Sources) bool {
+	return ipInSubnets(ip, cfg.TrustedSubnets) || src.TrustedSubnets.Contains(ip)
+}
+
+// chainClientIP picks the client IP from the hops listed by proxies, oldest first,
+// according to the configured strategy. Entries that are not addresses are invalid;
+// the rightmost strategy stops at them, since nothing to their left can be trusted.
+func chainClientIP(chain []netip.Addr, cfg config.ProxyConfig, src Sources) netip.Addr {
+	switch cfg.ClientIPStrategy {
+	case config.StrategyLeftmost:
+		for _, ip := range chain {
+			if ip.IsValid() {
+				return ip
+			}
+		}
+	case config.StrategyHops:
+		return hopClientIP(chain, cfg.TrustedHops)
+	default:
+		// Without trusted subnets every proxy is trusted and the walk ends at the
+		// leftmost hop.
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip := chain[i]
+
+			trusted := !cfg.SubnetsRestricted() || trustedProxy(ip, cfg, src)
+			if !ip.IsValid() || !trusted || i == 0 {
+				return ip
 			}
 		}
 	}
 
-	if remoteIP.IsValid() {
-		return remoteIP.String()
+	return netip.Addr{}
+}
+
+// hopClientIP returns the entry hops positions from the right of chain, or an invalid
+// address when the chain is shorter than that.
+func hopClientIP(chain []netip.Addr, hops int) netip.Addr {
+	if hops <= 0 || hops > len(chain) {
+		return netip.Addr{}
 	}
 
-	return ""
+	return chain[len(chain)-hops]
 }
 
 func parseRemoteAddr(addr string) (netip.Addr, bool) {
@@ -57,26 +180,24 @@ func parseIP(value string) (netip.Addr, bool) {
 	return ip, true
 }
 
-func firstForwardedIP(header string) netip.Addr {
-	if header == "" {
-		return netip.Addr{}
-	}
+// forwardedForChain parses the entries of an X-Forwarded-For header. Entries that
+// are not addresses yield an invalid address; empty ones are skipped.
+func forwardedForChain(header string) []netip.Addr {
+	var chain []netip.Addr
 
-	parts := strings.Split(header, ",")
-	for _, part := range parts {
-		if ip, ok := parseIP(part); ok {
-			return ip
+	for _, part := range strings.Split(header, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
 		}
+
+		ip, _ := parseIP(part)
+		chain = append(chain, ip)
 	}
 
-	return netip.Addr{}
+	return chain
 }
 
-func ipAllowed(ip netip.Addr, subnets []netip.Prefix) bool {
-	if len(subnets) == 0 {
-		return true
-	}
-
+func ipInSubnets(ip netip.Addr, subnets []netip.Prefix) bool {
 	for _, prefix := range subnets {
 		if prefix.Contains(ip) {
 			return true
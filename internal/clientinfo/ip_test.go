@@ -1,64 +1,262 @@
 package clientinfo
 
 import (
+	"context"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"net/netip"
 	"testing"
 
 	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/subnets"
 )
 
 func TestResolveClientIP(t *testing.T) {
+	defaultHeaders := config.Default().Proxy.ClientIPHeaders
+
 	t.Run("forwarded header ignored when untrusted", func(t *testing.T) {
 		cfg := config.ProxyConfig{TrustForwarded: false}
 		req := httptest.NewRequest("GET", "http://example.com", nil)
 		req.RemoteAddr = "203.0.113.10:1234"
 		req.Header.Set("X-Forwarded-For", "198.51.100.3")
 
-		if got := resolveClientIP(req, cfg); got != "203.0.113.10" {
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "203.0.113.10" {
 			t.Fatalf("expected remote IP, got %s", got)
 		}
 	})
 
 	t.Run("forwarded header respected", func(t *testing.T) {
-		cfg := config.ProxyConfig{TrustForwarded: true}
+		cfg := config.ProxyConfig{TrustForwarded: true, ClientIPHeaders: defaultHeaders}
 		req := httptest.NewRequest("GET", "http://example.com", nil)
 		req.RemoteAddr = "203.0.113.10:1234"
 		req.Header.Set("X-Forwarded-For", "198.51.100.3, 203.0.113.10")
 
-		if got := resolveClientIP(req, cfg); got != "198.51.100.3" {
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "198.51.100.3" {
 			t.Fatalf("expected forwarded IP, got %s", got)
 		}
 	})
 
 	t.Run("trusted subnets enforced", func(t *testing.T) {
 		cfg := config.ProxyConfig{
-			TrustForwarded: true,
-			TrustedSubnets: []netip.Prefix{mustPrefix("10.0.0.0/8")},
+			TrustForwarded:  true,
+			ClientIPHeaders: defaultHeaders,
+			TrustedSubnets:  []netip.Prefix{mustPrefix("10.0.0.0/8")},
 		}
 
 		req := httptest.NewRequest("GET", "http://example.com", nil)
 		req.RemoteAddr = "203.0.113.10:1234"
 		req.Header.Set("X-Forwarded-For", "198.51.100.3")
 
-		if got := resolveClientIP(req, cfg); got != "203.0.113.10" {
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "203.0.113.10" {
 			t.Fatalf("expected remote IP due to untrusted proxy, got %s", got)
 		}
 	})
 
 	t.Run("x-real-ip fallback", func(t *testing.T) {
 		cfg := config.ProxyConfig{
-			TrustForwarded: true,
-			TrustedSubnets: []netip.Prefix{mustPrefix("203.0.113.0/24")},
+			TrustForwarded:  true,
+			ClientIPHeaders: defaultHeaders,
+			TrustedSubnets:  []netip.Prefix{mustPrefix("203.0.113.0/24")},
 		}
 		req := httptest.NewRequest("GET", "http://example.com", nil)
 		req.RemoteAddr = "203.0.113.10:1234"
 		req.Header.Set("X-Real-IP", "198.51.100.77")
 
-		if got := resolveClientIP(req, cfg); got != "198.51.100.77" {
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "198.51.100.77" {
 			t.Fatalf("expected X-Real-IP, got %s", got)
 		}
 	})
+
+	t.Run("subnets from files", func(t *testing.T) {
+		list := &subnets.List{}
+		cfg := config.ProxyConfig{
+			TrustForwarded:     true,
+			ClientIPHeaders:    defaultHeaders,
+			TrustedSubnetFiles: []string{"cdn.txt"},
+		}
+		src := Sources{TrustedSubnets: list}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "203.0.113.10:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.3")
+
+		// An empty file must not turn into trusting every peer.
+		if got := resolveClientIP(req, cfg, src).String(); got != "203.0.113.10" {
+			t.Fatalf("expected remote IP with an empty list, got %s", got)
+		}
+
+		list.Store([]netip.Prefix{mustPrefix("203.0.113.0/24")})
+
+		if got := resolveClientIP(req, cfg, src).String(); got != "198.51.100.3" {
+			t.Fatalf("expected forwarded IP after the list was loaded, got %s", got)
+		}
+	})
+
+	t.Run("forwarded header", func(t *testing.T) {
+		cfg := config.ProxyConfig{TrustForwarded: true, ClientIPHeaders: defaultHeaders}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "203.0.113.10:1234"
+		req.Header.Set("Forwarded", `for=unknown, for="[2001:db8:cafe::17]:4711";proto=https`)
+
+		// Without trusted subnets the rightmost strategy walks past the IPv6 hop and
+		// stops at the unknown one, so the peer address is used instead of the
+		// leftmost entry the legacy behavior returned.
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "203.0.113.10" {
+			t.Fatalf("expected remote IP, got %s", got)
+		}
+	})
+
+	t.Run("unix socket peer", func(t *testing.T) {
+		cfg := config.ProxyConfig{
+			TrustForwarded:  true,
+			ClientIPHeaders: defaultHeaders,
+			TrustedSubnets:  []netip.Prefix{mustPrefix("10.0.0.0/8")},
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey,
+			&net.UnixAddr{Name: "/run/ip-detect.sock", Net: "unix"}))
+		req.RemoteAddr = "@"
+		req.Header.Set("X-Forwarded-For", "198.51.100.3")
+
+		if got := resolveClientIP(req, cfg, Sources{}); got.IsValid() {
+			t.Fatalf("expected no client IP from an untrusted socket, got %s", got)
+		}
+
+		cfg.TrustUnixSockets = true
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "198.51.100.3" {
+			t.Fatalf("expected forwarded IP from a trusted socket, got %s", got)
+		}
+	})
+
+	t.Run("header order", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "203.0.113.10:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.3")
+		req.Header.Set("Forwarded", "for=198.51.100.4")
+
+		cfg := config.ProxyConfig{TrustForwarded: true, ClientIPHeaders: defaultHeaders}
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "198.51.100.3" {
+			t.Fatalf("expected X-Forwarded-For IP by default, got %s", got)
+		}
+
+		cfg.ClientIPHeaders = []string{config.HeaderForwarded, config.HeaderXForwardedFor}
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "198.51.100.4" {
+			t.Fatalf("expected Forwarded IP first, got %s", got)
+		}
+
+		cfg.ClientIPHeaders = []string{config.HeaderXRealIP}
+		if got := resolveClientIP(req, cfg, Sources{}).String(); got != "203.0.113.10" {
+			t.Fatalf("expected remote IP when no listed header is set, got %s", got)
+		}
+	})
+}
+
+func TestClientIPStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		hops     int
+		header   string
+		value    string
+		want     string
+	}{
+		{"rightmost skips trusted proxies", config.StrategyRightmost, 0,
+			"X-Forwarded-For", "1.1.1.1, 198.51.100.3, 10.0.0.2, 10.0.0.1", "198.51.100.3"},
+		{"rightmost all trusted", config.StrategyRightmost, 0,
+			"X-Forwarded-For", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"rightmost stops at garbage", config.StrategyRightmost, 0,
+			"X-Forwarded-For", "198.51.100.3, bogus, 10.0.0.1", "203.0.113.10"},
+		{"rightmost stops at unknown", config.StrategyRightmost, 0,
+			"Forwarded", "for=198.51.100.3, for=unknown, for=10.0.0.1", "203.0.113.10"},
+		{"rightmost forwarded", config.StrategyRightmost, 0,
+			"Forwarded", `for=1.1.1.1, for="[2001:db8::1]:443", for=10.0.0.1`, "2001:db8::1"},
+		{"hops", config.StrategyHops, 2,
+			"X-Forwarded-For", "1.1.1.1, 198.51.100.3, 10.0.0.1", "198.51.100.3"},
+		{"hops chain too short", config.StrategyHops, 3,
+			"X-Forwarded-For", "198.51.100.3, 10.0.0.1", "203.0.113.10"},
+		{"leftmost", config.StrategyLeftmost, 0,
+			"X-Forwarded-For", "bogus, 1.1.1.1, 198.51.100.3", "1.1.1.1"},
+		{"leftmost skips unknown", config.StrategyLeftmost, 0,
+			"Forwarded", "for=unknown, for=_hidden, for=1.1.1.1", "1.1.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ProxyConfig{
+				TrustForwarded:   true,
+				ClientIPHeaders:  []string{config.HeaderXForwardedFor, config.HeaderForwarded},
+				ClientIPStrategy: tt.strategy,
+				TrustedHops:      tt.hops,
+				TrustedSubnets:   []netip.Prefix{mustPrefix("10.0.0.0/8"), mustPrefix("203.0.113.0/24")},
+			}
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			req.RemoteAddr = "203.0.113.10:1234"
+			req.Header.Set(tt.header, tt.value)
+
+			if got := resolveClientIP(req, cfg, Sources{}).String(); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProviderClientIP(t *testing.T) {
+	edges := &subnets.List{}
+	edges.Store([]netip.Prefix{mustPrefix("173.245.48.0/20")})
+
+	google := &subnets.List{}
+	google.Store([]netip.Prefix{mustPrefix("35.191.0.0/16")})
+
+	cfg := config.ProxyConfig{
+		ClientIPHeaders: config.Default().Proxy.ClientIPHeaders,
+		TrustedSubnets:  []netip.Prefix{mustPrefix("10.0.0.0/8")},
+		Presets: []config.ClientIPProvider{
+			{Name: "cloudflare", Header: "CF-Connecting-IP", File: "cloudflare.txt"},
+			{Name: "google", Header: "X-Forwarded-For", Hops: 2, File: "google.txt"},
+		},
+		CustomIPHeaders: []config.ClientIPProvider{
+			{Name: "X-Edge-Client", Header: "X-Edge-Client", File: "cloudflare.txt"},
+		},
+	}
+	src := Sources{ProviderSubnets: map[string]*subnets.List{"cloudflare.txt": edges, "google.txt": google}}
+
+	tests := []struct {
+		name           string
+		trustForwarded bool
+		remote         string
+		headers        map[string]string
+		want           string
+	}{
+		{"direct from edge", false, "173.245.49.1:443",
+			map[string]string{"CF-Connecting-IP": "198.51.100.3"}, "198.51.100.3"},
+		{"spoofed outside the ranges", false, "203.0.113.10:443",
+			map[string]string{"CF-Connecting-IP": "198.51.100.3"}, "203.0.113.10"},
+		{"edge behind a trusted proxy", true, "10.0.0.1:443",
+			map[string]string{"X-Forwarded-For": "173.245.49.1", "CF-Connecting-IP": "198.51.100.3"}, "198.51.100.3"},
+		{"custom header as fallback", false, "173.245.49.1:443",
+			map[string]string{"X-Edge-Client": "2001:db8::7"}, "2001:db8::7"},
+		{"missing header", false, "173.245.49.1:443", nil, "173.245.49.1"},
+		{"google hops", false, "35.191.3.4:443",
+			map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.3, 34.8.0.1"}, "198.51.100.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cfg
+			cfg.TrustForwarded = tt.trustForwarded
+
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			req.RemoteAddr = tt.remote
+
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			if got := resolveClientIP(req, cfg, src).String(); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
 }
 
 func mustPrefix(value string) netip.Prefix {
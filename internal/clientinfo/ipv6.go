@@ -0,0 +1,159 @@
+package clientinfo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"git.skobk.in/skobkin/ip-detect/internal/oui"
+)
+
+// Transition mechanisms reported in IPv6Info.Mechanism.
+const (
+	mechanismIPv4Mapped     = "ipv4-mapped"
+	mechanismIPv4Compatible = "ipv4-compatible"
+	mechanism6to4           = "6to4"
+	mechanismTeredo         = "teredo"
+	mechanismNAT64          = "nat64"
+	mechanismISATAP         = "isatap"
+)
+
+// Interface identifier types reported in IPv6Info.InterfaceIDType.
+const (
+	interfaceIDEUI64      = "eui-64"
+	interfaceIDISATAP     = "isatap"
+	interfaceIDLowByte    = "low-byte"
+	interfaceIDRandomized = "randomized"
+)
+
+var (
+	prefix6to4   = netip.MustParsePrefix("2002::/16")
+	prefixTeredo = netip.MustParsePrefix("2001::/32")
+	prefixNAT64  = netip.MustParsePrefix("64:ff9b::/96")
+)
+
+// buildIPv6Info decodes what an IPv6 address reveals about the transition mechanism
+// in use and how its interface identifier was formed. It returns nil for IPv4.
+func buildIPv6Info(ip netip.Addr) *IPv6Info {
+	if !ip.Is6() {
+		return nil
+	}
+
+	b := ip.As16()
+	info := IPv6Info{}
+
+	switch {
+	case ip.Is4In6():
+		info.Mechanism = stringPtr(mechanismIPv4Mapped)
+		info.EmbeddedIPv4 = stringPtr(ip.Unmap().String())
+
+		return &info
+	case isIPv4Compatible(b):
+		info.Mechanism = stringPtr(mechanismIPv4Compatible)
+		info.EmbeddedIPv4 = stringPtr(ipv4At(b, 12).String())
+
+		return &info
+	case prefixNAT64.Contains(ip):
+		info.Mechanism = stringPtr(mechanismNAT64)
+		info.EmbeddedIPv4 = stringPtr(ipv4At(b, 12).String())
+
+		return &info
+	case prefixTeredo.Contains(ip):
+		// The client address and port are stored inverted so that NATs do not
+		// rewrite them.
+		var client [4]byte
+		for i := range client {
+			client[i] = ^b[12+i]
+		}
+
+		clientIP := netip.AddrFrom4(client)
+		info.Mechanism = stringPtr(mechanismTeredo)
+		info.EmbeddedIPv4 = stringPtr(clientIP.String())
+		info.Teredo = &TeredoInfo{
+			Server:     ipv4At(b, 4).String(),
+			ClientIP:   clientIP.String(),
+			ClientPort: int(^binary.BigEndian.Uint16(b[10:12])),
+		}
+
+		return &info
+	case prefix6to4.Contains(ip):
+		info.Mechanism = stringPtr(mechanism6to4)
+		info.EmbeddedIPv4 = stringPtr(ipv4At(b, 2).String())
+	}
+
+	describeInterfaceID(&info, b)
+
+	return &info
+}
+
+// describeInterfaceID classifies the lower 64 bits of the address.
+func describeInterfaceID(info *IPv6Info, b [16]byte) {
+	iid := b[8:]
+	info.InterfaceID = stringPtr(fmt.Sprintf("%04x:%04x:%04x:%04x",
+		binary.BigEndian.Uint16(iid[0:2]), binary.BigEndian.Uint16(iid[2:4]),
+		binary.BigEndian.Uint16(iid[4:6]), binary.BigEndian.Uint16(iid[6:8])))
+
+	switch {
+	case iid[0]&^0x03 == 0 && iid[1] == 0 && iid[2] == 0x5e && iid[3] == 0xfe:
+		// RFC 5214: 0000:5efe or 0200:5efe followed by the IPv4 address.
+		info.InterfaceIDType = stringPtr(interfaceIDISATAP)
+		info.EmbeddedIPv4 = stringPtr(ipv4At(b, 12).String())
+
+		if info.Mechanism == nil {
+			info.Mechanism = stringPtr(mechanismISATAP)
+		}
+	case iid[3] == 0xff && iid[4] == 0xfe:
+		// RFC 4291 appendix A: the MAC address split by ff:fe with the
+		// universal/local bit inverted.
+		mac := [6]byte{iid[0] ^ 0x02, iid[1], iid[2], iid[5], iid[6], iid[7]}
+		info.InterfaceIDType = stringPtr(interfaceIDEUI64)
+		info.MACAddress = stringPtr(net.HardwareAddr(mac[:]).String())
+
+		if vendor, ok := oui.Vendor(mac); ok {
+			info.Vendor = stringPtr(vendor)
+		}
+	case binary.BigEndian.Uint64(iid)>>16 == 0:
+		// Manually assigned addresses such as ::1 or ::53.
+		info.InterfaceIDType = stringPtr(interfaceIDLowByte)
+	case looksRandom(iid):
+		info.InterfaceIDType = stringPtr(interfaceIDRandomized)
+		info.LikelyPrivacy = true
+	}
+}
+
+// looksRandom reports whether an interface identifier has as few zero nibbles as a
+// random one would. Temporary (RFC 8981) and stable privacy (RFC 7217) identifiers
+// are random; configured ones usually are not.
+func looksRandom(iid []byte) bool {
+	const maxZeroNibbles = 4
+
+	zeros := 0
+
+	for _, octet := range iid {
+		if octet>>4 == 0 {
+			zeros++
+		}
+
+		if octet&0x0f == 0 {
+			zeros++
+		}
+	}
+
+	return zeros <= maxZeroNibbles
+}
+
+func isIPv4Compatible(b [16]byte) bool {
+	for _, octet := range b[:12] {
+		if octet != 0 {
+			return false
+		}
+	}
+
+	// :: and ::1 share the prefix but are the unspecified and loopback addresses.
+	return binary.BigEndian.Uint32(b[12:]) > 1
+}
+
+func ipv4At(b [16]byte, offset int) netip.Addr {
+	return netip.AddrFrom4([4]byte(b[offset : offset+4]))
+}
@@ -0,0 +1,57 @@
+package clientinfo
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestBuildIPv6Info(t *testing.T) {
+	tests := []struct {
+		ip                  string
+		mechanism, embedded string
+		idType, mac, vendor string
+		privacy             bool
+	}{
+		{"::ffff:192.0.2.1", mechanismIPv4Mapped, "192.0.2.1", "", "", "", false},
+		{"::192.0.2.1", mechanismIPv4Compatible, "192.0.2.1", "", "", "", false},
+		{"64:ff9b::c000:201", mechanismNAT64, "192.0.2.1", "", "", "", false},
+		{"2002:c000:201::1", mechanism6to4, "192.0.2.1", interfaceIDLowByte, "", "", false},
+		{"2001:db8::5efe:c000:201", mechanismISATAP, "192.0.2.1", interfaceIDISATAP, "", "", false},
+		{"2001:db8::250:56ff:fe01:203", "", "", interfaceIDEUI64, "00:50:56:01:02:03", "VMware, Inc.", false},
+		{"fe80::5054:ff:fe12:3456", "", "", interfaceIDEUI64, "52:54:00:12:34:56", "", false},
+		{"2001:db8::3c4d:9a7e:b21f:68c5", "", "", interfaceIDRandomized, "", "", true},
+		{"2001:db8::1000:0:0:1", "", "", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		info := buildIPv6Info(netip.MustParseAddr(tt.ip))
+		if info == nil {
+			t.Fatalf("buildIPv6Info(%s) = nil", tt.ip)
+		}
+
+		got := [5]string{deref(info.Mechanism), deref(info.EmbeddedIPv4), deref(info.InterfaceIDType), deref(info.MACAddress), deref(info.Vendor)}
+		want := [5]string{tt.mechanism, tt.embedded, tt.idType, tt.mac, tt.vendor}
+
+		if got != want || info.LikelyPrivacy != tt.privacy {
+			t.Errorf("buildIPv6Info(%s) = %q (privacy %v), want %q (privacy %v)", tt.ip, got, info.LikelyPrivacy, want, tt.privacy)
+		}
+	}
+
+	if info := buildIPv6Info(netip.MustParseAddr("192.0.2.1")); info != nil {
+		t.Fatalf("expected no IPv6 data for IPv4, got %+v", info)
+	}
+}
+
+func TestBuildIPv6InfoTeredo(t *testing.T) {
+	// RFC 4380 example: server 65.54.227.120, client 192.0.2.45:40000.
+	info := buildIPv6Info(netip.MustParseAddr("2001:0:4136:e378:8000:63bf:3fff:fdd2"))
+
+	if info == nil || info.Teredo == nil || deref(info.Mechanism) != mechanismTeredo {
+		t.Fatalf("expected Teredo data, got %+v", info)
+	}
+
+	want := TeredoInfo{Server: "65.54.227.120", ClientIP: "192.0.2.45", ClientPort: 40000}
+	if *info.Teredo != want || deref(info.EmbeddedIPv4) != want.ClientIP {
+		t.Fatalf("unexpected Teredo data: %+v", *info.Teredo)
+	}
+}
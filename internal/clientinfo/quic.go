@@ -0,0 +1,36 @@
+package clientinfo
+
+import "context"
+
+// RecordQUICConn registers a callback describing the QUIC connection the context
+// belongs to. It is evaluated per request, so that connection migration and the
+// 0-RTT state are reported as observed at that point.
+func RecordQUICConn(ctx context.Context, describe func() QUICInfo) {
+	state := connStateFrom(ctx)
+	if state == nil {
+		return
+	}
+
+	state.mu.Lock()
+	state.quic = describe
+	state.mu.Unlock()
+}
+
+func quicInfoFrom(ctx context.Context) *QUICInfo {
+	state := connStateFrom(ctx)
+	if state == nil {
+		return nil
+	}
+
+	state.mu.Lock()
+	describe := state.quic
+	state.mu.Unlock()
+
+	if describe == nil {
+		return nil
+	}
+
+	info := describe()
+
+	return &info
+}
@@ -2,18 +2,25 @@ package clientinfo
 
 import (
 	"crypto/tls"
+	"math"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
 )
 
 const (
 	headerEntryExtraCapacity = 2
-	forwardedParamParts      = 2
+
+	// sourceConnection marks connection details taken from the request itself rather
+	// than from a trusted proxy header, which is reported by name.
+	sourceConnection = "connection"
 )
 
-func buildConnectionInfo(r *http.Request, resolvedIP string) *ConnectionInfo {
+func buildConnectionInfo(r *http.Request, resolvedIP string, cfg config.ProxyConfig, src Sources) *ConnectionInfo {
 	remoteAddr := stringPtr(resolvedIP)
 	if remoteAddr == nil {
 		if addr, ok := parseRemoteAddr(r.RemoteAddr); ok {
@@ -21,11 +28,21 @@ func buildConnectionInfo(r *http.Request, resolvedIP string) *ConnectionInfo {
 		}
 	}
 
+	trusted := proxyTrusted(r, cfg, src)
+	scheme, schemeSource := detectScheme(r, trusted)
+	host, hostSource := detectHost(r, trusted)
+	port, portSource := detectPort(r, host, hostSource, trusted)
+
 	info := ConnectionInfo{
-		Scheme:     stringPtr(detectScheme(r)),
-		Protocol:   stringPtr(r.Proto),
-		Host:       stringPtr(r.Host),
-		RemoteAddr: remoteAddr,
+		Scheme:       stringPtr(scheme),
+		SchemeSource: stringPtr(schemeSource),
+		Protocol:     stringPtr(r.Proto),
+		Host:         stringPtr(host),
+		HostSource:   stringPtr(hostSource),
+		Port:         stringPtr(port),
+		PortSource:   stringPtr(portSource),
+		RemoteAddr:   remoteAddr,
+		QUIC:         quicInfoFrom(r.Context()),
 	}
 
 	if !hasPtr(info.Scheme, info.Protocol, info.Host, info.RemoteAddr) {
@@ -35,16 +52,45 @@ func buildConnectionInfo(r *http.Request, resolvedIP string) *ConnectionInfo {
 	return &info
 }
 
-func buildTLSInfo(r *http.Request) *TLSInfo {
+func buildTLSInfo(r *http.Request, cfg config.ProxyConfig, src Sources) *TLSInfo {
 	if r.TLS == nil {
+		if cfg.TLSHeaders.Enabled() && proxyTrusted(r, cfg, src) {
+			return buildUpstreamTLSInfo(r, cfg.TLSHeaders)
+		}
+
 		return nil
 	}
 
 	info := TLSInfo{
+		Source:             stringPtr(tlsSourceDirect),
 		Version:            stringPtr(tls.VersionName(r.TLS.Version)),
 		CipherSuite:        stringPtr(tls.CipherSuiteName(r.TLS.CipherSuite)),
 		ServerName:         stringPtr(r.TLS.ServerName),
 		NegotiatedProtocol: stringPtr(r.TLS.NegotiatedProtocol),
+		Resumed:            boolPtr(r.TLS.DidResume),
+		ECHAccepted:        boolPtr(r.TLS.ECHAccepted),
+	}
+
+	// crypto/tls never accepts TLS 1.3 early data over TCP, so it is only known,
+	// and only applies, for HTTP/3.
+	if quic := quicInfoFrom(r.Context()); quic != nil {
+		info.EarlyData = quic.Used0RTT
+	}
+
+	if r.TLS.CurveID != 0 {
+		info.KeyExchange = stringPtr(r.TLS.CurveID.String())
+	}
+
+	if served := servedCertificateFrom(r.Context()); served != nil {
+		info.OCSPStapled = boolPtr(served.ocspStapled)
+		info.SCTStapled = boolPtr(served.sctStapled)
+	}
+
+	if hello := clientHelloFrom(r.Context()); hello != nil {
+		info.ClientHello = &hello.info
+		info.JA3 = stringPtr(hello.ja3)
+		info.JA3Hash = stringPtr(hello.ja3Hash)
+		info.JA4 = stringPtr(hello.ja4)
 	}
 
 	if !hasPtr(info.Version, info.CipherSuite, info.ServerName, info.NegotiatedProtocol) {
@@ -178,28 +224,81 @@ func collectRequestHeaders(r *http.Request) []HeaderEntry {
 	return entries
 }
 
-func detectScheme(r *http.Request) string {
-	if r.TLS != nil {
-		return "https"
+// detectScheme returns the scheme the client used and its source. A trusted proxy's
+// X-Forwarded-Proto or Forwarded proto= takes precedence over the connection, since the
+// proxy saw the client's side of it.
+func detectScheme(r *http.Request, trusted bool) (string, string) {
+	if trusted {
+		if proto := firstHeaderToken(headerValue(r, "X-Forwarded-Proto")); proto != "" {
+			return proto, "X-Forwarded-Proto"
+		}
+
+		if proto := forwardedParam(headerValue(r, "Forwarded"), "proto"); proto != "" {
+			return proto, "Forwarded"
+		}
 	}
 
-	if proto := firstHeaderToken(headerValue(r, "X-Forwarded-Proto")); proto != "" {
-		return proto
+	switch {
+	case r.TLS != nil:
+		return "https", sourceConnection
+	case r.URL != nil && r.URL.Scheme != "":
+		return r.URL.Scheme, sourceConnection
+	case r.Proto != "":
+		return "http", sourceConnection
+	default:
+		return "", ""
 	}
+}
 
-	if proto := forwardedParam(headerValue(r, "Forwarded"), "proto"); proto != "" {
-		return proto
+// detectHost returns the host the client asked for and its source: the Host header,
+// or X-Forwarded-Host or Forwarded host= from a trusted proxy.
+func detectHost(r *http.Request, trusted bool) (string, string) {
+	if trusted {
+		if host := firstHeaderToken(headerValue(r, "X-Forwarded-Host")); host != "" {
+			return host, "X-Forwarded-Host"
+		}
+
+		if host := forwardedParam(headerValue(r, "Forwarded"), "host"); host != "" {
+			return host, "Forwarded"
+		}
+	}
+
+	if r.Host == "" {
+		return "", ""
+	}
+
+	return r.Host, sourceConnection
+}
+
+// detectPort returns the port the client connected to and its source: a trusted
+// X-Forwarded-Port, the port in host, or the local port of the connection when host
+// came from it.
+func detectPort(r *http.Request, host, hostSource string, trusted bool) (string, string) {
+	if trusted {
+		if port := firstHeaderToken(headerValue(r, "X-Forwarded-Port")); validPort(port) {
+			return port, "X-Forwarded-Port"
+		}
 	}
 
-	if r.URL != nil && r.URL.Scheme != "" {
-		return r.URL.Scheme
+	if _, port, err := net.SplitHostPort(host); err == nil && validPort(port) {
+		return port, hostSource
 	}
 
-	if r.Proto != "" {
-		return "http"
+	if hostSource != sourceConnection && hostSource != "" {
+		return "", ""
 	}
 
-	return ""
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok && addr.Port > 0 {
+		return strconv.Itoa(addr.Port), sourceConnection
+	}
+
+	return "", ""
+}
+
+func validPort(value string) bool {
+	port, err := strconv.Atoi(value)
+
+	return err == nil && port > 0 && port <= math.MaxUint16
 }
 
 func headerValue(r *http.Request, key string) string {
@@ -235,36 +334,6 @@ func firstHeaderToken(value string) string {
 	return strings.TrimSpace(parts[0])
 }
 
-func forwardedParam(value, key string) string {
-	if value == "" {
-		return ""
-	}
-
-	entries := strings.Split(value, ",")
-	for _, entry := range entries {
-		params := strings.Split(entry, ";")
-		for _, param := range params {
-			param = strings.TrimSpace(param)
-			if param == "" {
-				continue
-			}
-
-			parts := strings.SplitN(param, "=", forwardedParamParts)
-			if len(parts) != forwardedParamParts {
-				continue
-			}
-
-			if !strings.EqualFold(strings.TrimSpace(parts[0]), key) {
-				continue
-			}
-
-			return strings.Trim(strings.TrimSpace(parts[1]), "\"")
-		}
-	}
-
-	return ""
-}
-
 func hasPtr(values ...*string) bool {
 	for _, value := range values {
 		if value != nil {
@@ -275,6 +344,10 @@ func hasPtr(values ...*string) bool {
 	return false
 }
 
+func boolPtr(value bool) *bool {
+	return &value
+}
+
 func stringPtr(value string) *string {
 	value = strings.TrimSpace(value)
 	if value == "" {
@@ -0,0 +1,87 @@
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestBuildConnectionInfo(t *testing.T) {
+	trusted := config.ProxyConfig{
+		TrustForwarded: true,
+		TrustedSubnets: []netip.Prefix{mustPrefix("10.0.0.0/8")},
+	}
+
+	headers := map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "public.example.com",
+		"X-Forwarded-Port":  "443",
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.ProxyConfig
+		remote  string
+		headers map[string]string
+		want    [6]string
+	}{
+		{"untrusted client", config.ProxyConfig{}, "203.0.113.10:1234", headers,
+			[6]string{"http", sourceConnection, "internal:8080", sourceConnection, "8080", sourceConnection}},
+		{"untrusted peer", trusted, "203.0.113.10:1234", headers,
+			[6]string{"http", sourceConnection, "internal:8080", sourceConnection, "8080", sourceConnection}},
+		{"trusted proxy", trusted, "10.0.0.1:1234", headers,
+			[6]string{"https", "X-Forwarded-Proto", "public.example.com", "X-Forwarded-Host", "443", "X-Forwarded-Port"}},
+		{"forwarded header", trusted, "10.0.0.1:1234",
+			map[string]string{"Forwarded": `for=192.0.2.1;proto=https;host="public.example.com:8443"`},
+			[6]string{"https", "Forwarded", "public.example.com:8443", "Forwarded", "8443", "Forwarded"}},
+		{"forwarded host without port", trusted, "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-Host": "public.example.com", "X-Forwarded-Port": "bogus"},
+			[6]string{"http", sourceConnection, "public.example.com", "X-Forwarded-Host", "", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://internal:8080/", nil)
+			req.RemoteAddr = tt.remote
+
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			info := buildConnectionInfo(req, "", tt.cfg, Sources{})
+			got := [6]string{
+				deref(info.Scheme), deref(info.SchemeSource),
+				deref(info.Host), deref(info.HostSource),
+				deref(info.Port), deref(info.PortSource),
+			}
+
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("local port", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://internal/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey,
+			&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9090}))
+
+		info := buildConnectionInfo(req, "", config.ProxyConfig{}, Sources{})
+		if deref(info.Port) != "9090" || deref(info.PortSource) != sourceConnection {
+			t.Fatalf("expected the local port, got %q from %q", deref(info.Port), deref(info.PortSource))
+		}
+	})
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -2,25 +2,103 @@ package clientinfo
 
 import (
 	"context"
-	"net"
+	"net/netip"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/net/idna"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
 )
 
 const fallbackLookupTimeout = 200 * time.Millisecond
 
-func reverseLookup(ctx context.Context, ip string, timeout time.Duration) string {
-	if timeout <= 0 {
-		timeout = fallbackLookupTimeout
+// maxPTRNames bounds the forward lookups made for a single address.
+const maxPTRNames = 10
+
+// Forward confirmation states reported in PTRName.Forward.
+const (
+	forwardConfirmed    = "confirmed"
+	forwardMismatch     = "mismatch"
+	forwardLookupFailed = "lookup_failed"
+)
+
+// resolver is the part of *net.Resolver used for reverse DNS.
+type resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// reverseLookup returns the PTR names of ip. Each name is resolved again to check
+// whether one of its A or AAAA records is ip. The PTR lookup and the forward
+// lookups, which run in parallel, each have their own timeout.
+func reverseLookup(ctx context.Context, r resolver, ip netip.Addr, cfg config.ResolverConfig) *ReverseDNSInfo {
+	names := lookupPTR(ctx, r, ip, cfg.LookupTimeout)
+	if len(names) == 0 {
+		return nil
+	}
+
+	if len(names) > maxPTRNames {
+		names = names[:maxPTRNames]
+	}
+
+	forwardCtx, cancel := context.WithTimeout(ctx, lookupTimeout(cfg.ForwardTimeout))
+	defer cancel()
+
+	info := ReverseDNSInfo{Names: make([]PTRName, len(names))}
+
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		name = strings.TrimSuffix(name, ".")
+		info.Names[i] = PTRName{Name: name}
+
+		if unicode, err := idna.Display.ToUnicode(name); err == nil && unicode != name {
+			info.Names[i].Unicode = &unicode
+		}
+
+		wg.Go(func() {
+			info.Names[i].Forward = forwardStatus(forwardCtx, r, name, ip)
+		})
 	}
 
-	resolverCtx, cancel := context.WithTimeout(ctx, timeout)
+	wg.Wait()
+
+	return &info
+}
+
+func lookupPTR(ctx context.Context, r resolver, ip netip.Addr, timeout time.Duration) []string {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout(timeout))
 	defer cancel()
 
-	names, err := net.DefaultResolver.LookupAddr(resolverCtx, ip)
-	if err != nil || len(names) == 0 {
-		return ""
+	names, err := r.LookupAddr(ctx, ip.String())
+	if err != nil {
+		return nil
+	}
+
+	return names
+}
+
+func lookupTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return fallbackLookupTimeout
+	}
+
+	return timeout
+}
+
+func forwardStatus(ctx context.Context, r resolver, name string, ip netip.Addr) string {
+	addrs, err := r.LookupNetIP(ctx, "ip", name)
+	if err != nil {
+		return forwardLookupFailed
+	}
+
+	for _, addr := range addrs {
+		if addr.Unmap() == ip.Unmap() {
+			return forwardConfirmed
+		}
 	}
 
-	return strings.TrimSuffix(names[0], ".")
+	return forwardMismatch
 }
@@ -0,0 +1,113 @@
+package clientinfo
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+type fakeResolver struct {
+	ptr     map[string][]string
+	forward map[string][]netip.Addr
+	// delay slows down every lookup, which then ignores its deadline for PTR
+	// records but honors it for forward lookups.
+	delay time.Duration
+}
+
+func (f fakeResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	time.Sleep(f.delay)
+
+	if names, ok := f.ptr[addr]; ok {
+		return names, nil
+	}
+
+	return nil, errors.New("no such host")
+}
+
+func (f fakeResolver) LookupNetIP(ctx context.Context, _, host string) ([]netip.Addr, error) {
+	time.Sleep(f.delay)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if addrs, ok := f.forward[host]; ok {
+		return addrs, nil
+	}
+
+	return nil, errors.New("no such host")
+}
+
+func TestReverseLookup(t *testing.T) {
+	r := fakeResolver{
+		ptr: map[string][]string{
+			"192.0.2.10":  {"spoofed.example.org.", "host.example.com.", "xn--bcher-kva.example.", "gone.example.net."},
+			"2001:db8::1": {"v6.example.com."},
+		},
+		forward: map[string][]netip.Addr{
+			"spoofed.example.org":   {netip.MustParseAddr("198.51.100.1")},
+			"host.example.com":      {netip.MustParseAddr("2001:db8::5"), netip.MustParseAddr("192.0.2.10")},
+			"xn--bcher-kva.example": {netip.MustParseAddr("::ffff:192.0.2.10")},
+			"v6.example.com":        {netip.MustParseAddr("2001:db8::2")},
+		},
+	}
+	cfg := config.ResolverConfig{LookupTimeout: time.Second, ForwardTimeout: time.Second}
+
+	info := reverseLookup(context.Background(), r, netip.MustParseAddr("192.0.2.10"), cfg)
+	if info == nil || len(info.Names) != 4 {
+		t.Fatalf("expected four names, got %+v", info)
+	}
+
+	want := []struct {
+		name, unicode, forward string
+	}{
+		{"spoofed.example.org", "", forwardMismatch},
+		{"host.example.com", "", forwardConfirmed},
+		{"xn--bcher-kva.example", "bücher.example", forwardConfirmed},
+		{"gone.example.net", "", forwardLookupFailed},
+	}
+
+	for i, w := range want {
+		got := info.Names[i]
+		if got.Name != w.name || deref(got.Unicode) != w.unicode || got.Forward != w.forward {
+			t.Errorf("name %d = %+v (unicode %q), want %+v", i, got, deref(got.Unicode), w)
+		}
+	}
+
+	info = reverseLookup(context.Background(), r, netip.MustParseAddr("2001:db8::1"), cfg)
+	if info == nil || info.Names[0].Forward != forwardMismatch {
+		t.Fatalf("expected an unconfirmed name, got %+v", info)
+	}
+
+	if info := reverseLookup(context.Background(), r, netip.MustParseAddr("203.0.113.1"), cfg); info != nil {
+		t.Fatalf("expected no data without PTR records, got %+v", info)
+	}
+}
+
+func TestReverseLookupForwardTimeout(t *testing.T) {
+	r := fakeResolver{
+		ptr:     map[string][]string{"192.0.2.10": {"host.example.com."}},
+		forward: map[string][]netip.Addr{"host.example.com": {netip.MustParseAddr("192.0.2.10")}},
+		delay:   30 * time.Millisecond,
+	}
+
+	// Together the lookups take longer than the PTR timeout, which must not cut
+	// the forward lookup short.
+	cfg := config.ResolverConfig{LookupTimeout: 50 * time.Millisecond, ForwardTimeout: time.Second}
+
+	info := reverseLookup(context.Background(), r, netip.MustParseAddr("192.0.2.10"), cfg)
+	if info == nil || info.Names[0].Forward != forwardConfirmed {
+		t.Fatalf("expected a confirmed name, got %+v", info)
+	}
+
+	cfg.ForwardTimeout = time.Millisecond
+
+	info = reverseLookup(context.Background(), r, netip.MustParseAddr("192.0.2.10"), cfg)
+	if info == nil || info.Names[0].Forward != forwardLookupFailed {
+		t.Fatalf("expected a failed forward lookup, got %+v", info)
+	}
+}
@@ -0,0 +1,177 @@
+package clientinfo
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+const (
+	tlsSourceDirect   = "direct"
+	tlsSourceUpstream = "upstream"
+
+	cloudFrontViewerTLSParts = 3
+)
+
+// upstreamTLSVersions maps the OpenSSL protocol names used by nginx, HAProxy and
+// CloudFront to the names crypto/tls reports for directly terminated connections.
+var upstreamTLSVersions = map[string]string{
+	"sslv3":   "SSLv3",
+	"tlsv1":   "TLS 1.0",
+	"tlsv1.0": "TLS 1.0",
+	"tlsv1.1": "TLS 1.1",
+	"tlsv1.2": "TLS 1.2",
+	"tlsv1.3": "TLS 1.3",
+}
+
+// buildUpstreamTLSInfo reads the TLS session details a trusted proxy passed on in headers.
+// Explicitly mapped headers take precedence over the combined CloudFront-Viewer-TLS value.
+func buildUpstreamTLSInfo(r *http.Request, headers config.UpstreamTLSHeaders) *TLSInfo {
+	info := TLSInfo{
+		Version:            stringPtr(normalizeTLSVersion(upstreamHeader(r, headers.Version))),
+		CipherSuite:        stringPtr(upstreamHeader(r, headers.CipherSuite)),
+		ServerName:         stringPtr(upstreamHeader(r, headers.ServerName)),
+		NegotiatedProtocol: stringPtr(upstreamHeader(r, headers.ALPN)),
+	}
+
+	if viewer := upstreamHeader(r, headers.CloudFrontViewerTLS); viewer != "" {
+		applyCloudFrontViewerTLS(&info, viewer)
+	}
+
+	if !hasPtr(info.Version, info.CipherSuite, info.ServerName, info.NegotiatedProtocol) {
+		return nil
+	}
+
+	info.Source = stringPtr(tlsSourceUpstream)
+
+	return &info
+}
+
+// applyCloudFrontViewerTLS fills the fields missing from info using a value such as
+// "TLSv1.3:TLS_AES_128_GCM_SHA256:fullHandshake".
+func applyCloudFrontViewerTLS(info *TLSInfo, value string) {
+	parts := strings.SplitN(value, ":", cloudFrontViewerTLSParts)
+
+	if info.Version == nil {
+		info.Version = stringPtr(normalizeTLSVersion(parts[0]))
+	}
+
+	if len(parts) > 1 && info.CipherSuite == nil {
+		info.CipherSuite = stringPtr(parts[1])
+	}
+
+	if len(parts) > 2 && info.Resumed == nil {
+		switch strings.TrimSpace(parts[2]) {
+		case "sessionResumed":
+			info.Resumed = boolPtr(true)
+		case "fullHandshake":
+			info.Resumed = boolPtr(false)
+		}
+	}
+}
+
+// buildUpstreamClientCertificateInfo decodes the client certificate a trusted proxy
+// forwarded, either as (URL-escaped) PEM or as base64-encoded DER.
+func buildUpstreamClientCertificateInfo(r *http.Request, headers config.UpstreamTLSHeaders) *ClientCertificateInfo {
+	certs := parseUpstreamCertificates(upstreamHeader(r, headers.ClientCert))
+	if len(certs) == 0 {
+		return nil
+	}
+
+	info := ClientCertificateInfo{
+		Source: stringPtr(tlsSourceUpstream),
+		Chain:  make([]CertificateInfo, 0, len(certs)),
+	}
+
+	for _, cert := range certs {
+		info.Chain = append(info.Chain, describeCertificate(cert))
+	}
+
+	info.Verified, info.VerificationError = parseUpstreamVerify(upstreamHeader(r, headers.ClientVerify))
+
+	return &info
+}
+
+func parseUpstreamCertificates(value string) []*x509.Certificate {
+	if value == "" {
+		return nil
+	}
+
+	if strings.Contains(value, "%") {
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+	}
+
+	if strings.Contains(value, "-----BEGIN") {
+		var certs []*x509.Certificate
+
+		rest := []byte(value)
+		for {
+			var block *pem.Block
+
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				return certs
+			}
+
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				certs = append(certs, cert)
+			}
+		}
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil
+	}
+
+	certs, err := x509.ParseCertificates(der)
+	if err != nil {
+		return nil
+	}
+
+	return certs
+}
+
+// parseUpstreamVerify understands nginx's $ssl_client_verify ("SUCCESS", "FAILED:reason",
+// "NONE") as well as HAProxy's numeric ssl_c_verify result (0 on success).
+func parseUpstreamVerify(value string) (*bool, *string) {
+	switch {
+	case value == "", strings.EqualFold(value, "NONE"):
+		return nil, nil
+	case strings.EqualFold(value, "SUCCESS"), value == "0":
+		return boolPtr(true), nil
+	}
+
+	if reason, ok := strings.CutPrefix(value, "FAILED:"); ok {
+		return boolPtr(false), stringPtr(reason)
+	}
+
+	return boolPtr(false), stringPtr(value)
+}
+
+func normalizeTLSVersion(value string) string {
+	if name, ok := upstreamTLSVersions[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return name
+	}
+
+	return value
+}
+
+func upstreamHeader(r *http.Request, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return headerValue(r, key)
+}
@@ -0,0 +1,145 @@
+package clientinfo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestUpstreamTLSInfo(t *testing.T) {
+	cfg := config.ProxyConfig{
+		TrustForwarded: true,
+		TrustedSubnets: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		TLSHeaders: config.UpstreamTLSHeaders{
+			Version:             "X-SSL-Protocol",
+			CipherSuite:         "X-SSL-Cipher",
+			CloudFrontViewerTLS: "CloudFront-Viewer-TLS",
+		},
+	}
+
+	t.Run("trusted proxy headers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-SSL-Protocol", "TLSv1.2")
+		req.Header.Set("X-SSL-Cipher", "ECDHE-RSA-AES128-GCM-SHA256")
+
+		info := buildTLSInfo(req, cfg, Sources{})
+		if info == nil {
+			t.Fatalf("expected upstream TLS info")
+		}
+
+		if *info.Source != "upstream" || *info.Version != "TLS 1.2" || *info.CipherSuite != "ECDHE-RSA-AES128-GCM-SHA256" {
+			t.Fatalf("unexpected TLS info: %+v", info)
+		}
+	})
+
+	t.Run("cloudfront viewer tls", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("CloudFront-Viewer-TLS", "TLSv1.3:TLS_AES_128_GCM_SHA256:sessionResumed")
+
+		info := buildTLSInfo(req, cfg, Sources{})
+		if info == nil {
+			t.Fatalf("expected upstream TLS info")
+		}
+
+		if *info.Version != "TLS 1.3" || *info.CipherSuite != "TLS_AES_128_GCM_SHA256" || info.Resumed == nil || !*info.Resumed {
+			t.Fatalf("unexpected TLS info: %+v", info)
+		}
+	})
+
+	t.Run("untrusted peer ignored", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "203.0.113.10:1234"
+		req.Header.Set("X-SSL-Protocol", "TLSv1.3")
+
+		if info := buildTLSInfo(req, cfg, Sources{}); info != nil {
+			t.Fatalf("expected no TLS info, got %+v", info)
+		}
+	})
+}
+
+func TestUpstreamClientCertificate(t *testing.T) {
+	der := newTestCertificate(t, "client.example")
+	pemCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	cfg := config.ProxyConfig{
+		TrustForwarded: true,
+		TLSHeaders: config.UpstreamTLSHeaders{
+			ClientCert:   "X-SSL-Client-Cert",
+			ClientVerify: "X-SSL-Client-Verify",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		cert     string
+		verify   string
+		verified *bool
+	}{
+		{name: "escaped PEM", cert: url.PathEscape(pemCert), verify: "SUCCESS", verified: boolPtr(true)},
+		{name: "base64 DER", cert: base64.StdEncoding.EncodeToString(der), verify: "FAILED:certificate has expired", verified: boolPtr(false)},
+		{name: "not verified", cert: url.PathEscape(pemCert)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			req.Header.Set("X-SSL-Client-Cert", tt.cert)
+			if tt.verify != "" {
+				req.Header.Set("X-SSL-Client-Verify", tt.verify)
+			}
+
+			info := buildClientCertificateInfo(req, cfg, Sources{})
+			if info == nil || len(info.Chain) != 1 {
+				t.Fatalf("missing client certificate: %+v", info)
+			}
+
+			if *info.Source != "upstream" || info.Chain[0].Subject != "CN=client.example" {
+				t.Fatalf("unexpected certificate info: %+v", info)
+			}
+
+			switch {
+			case tt.verified == nil && info.Verified != nil:
+				t.Fatalf("expected no verification, got %v", *info.Verified)
+			case tt.verified != nil && (info.Verified == nil || *info.Verified != *tt.verified):
+				t.Fatalf("expected verified=%v, got %v", *tt.verified, info.Verified)
+			}
+		})
+	}
+}
+
+func newTestCertificate(t *testing.T, cn string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	return der
+}
@@ -2,13 +2,20 @@
 package config
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/netip"
 	"os"
+	"os/user"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/subnets"
 )
 
 const (
@@ -16,41 +23,190 @@ const (
 	defaultWriteTimeout      = 5 * time.Second
 	defaultShutdownTimeout   = 10 * time.Second
 	defaultLookupTimeout     = 500 * time.Millisecond
+	defaultForwardTimeout    = 500 * time.Millisecond
 	defaultReadHeaderTimeout = 5 * time.Second
 	defaultIdleTimeout       = 30 * time.Second
 	defaultMaxHeaderBytes    = 1 << 20
+	defaultTLSReloadInterval = time.Minute
+	defaultACMEDirectoryURL  = "https://acme-v02.api.letsencrypt.org/directory"
+	defaultSubnetRefresh     = 5 * time.Minute
+	defaultDBReloadInterval  = time.Minute
+)
+
+// Headers that can carry the client IP, for ProxyConfig.ClientIPHeaders.
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// Ways to pick the client IP from the hops listed in X-Forwarded-For or Forwarded,
+// for ProxyConfig.ClientIPStrategy.
+const (
+	// StrategyRightmost walks the hops from the right, skipping trusted proxies, and
+	// picks the first address that is not one.
+	StrategyRightmost = "rightmost"
+	// StrategyHops picks the address TrustedHops entries from the right.
+	StrategyHops = "hops"
+	// StrategyLeftmost picks the leftmost address, which any client can forge. It is
+	// the behavior of earlier releases.
+	StrategyLeftmost = "leftmost"
 )
 
 // Config aggregates all configuration sections.
 type Config struct {
-	Server   ServerConfig
-	Proxy    ProxyConfig
-	Resolver ResolverConfig
-	Metadata MetadataConfig
-	Logging  LoggingConfig
+	Server     ServerConfig
+	Proxy      ProxyConfig
+	Resolver   ResolverConfig
+	Metadata   MetadataConfig
+	Enrichment EnrichmentConfig
+	Logging    LoggingConfig
+
+	// Warnings describe settings that are valid but may not do what was meant. They
+	// are filled in by Load and logged by the server on startup.
+	Warnings []string
 }
 
 // ServerConfig controls HTTP server behavior.
 type ServerConfig struct {
-	Addr              string
-	ReadTimeout       time.Duration
-	WriteTimeout      time.Duration
-	ReadHeaderTimeout time.Duration
-	IdleTimeout       time.Duration
-	MaxHeaderBytes    int
-	ShutdownTimeout   time.Duration
+	Addrs                []ListenAddr
+	ReadTimeout          time.Duration
+	WriteTimeout         time.Duration
+	ReadHeaderTimeout    time.Duration
+	IdleTimeout          time.Duration
+	MaxHeaderBytes       int
+	ShutdownTimeout      time.Duration
+	ProxyProtocol        bool
+	ProxyProtocolSubnets []netip.Prefix
+	TLSAddrs             []ListenAddr
+	UnixSocketMode       os.FileMode
+	UnixSocketUID        int
+	UnixSocketGID        int
+	TLSCertFile          string
+	TLSKeyFile           string
+	TLSReloadInterval    time.Duration
+	ConfigReloadInterval time.Duration
+	ACMEDomains          []string
+	ACMEDirectoryURL     string
+	ACMECacheDir         string
+	ACMEEmail            string
+	ACMECAFile           string
+	TLSClientAuth        tls.ClientAuthType
+	TLSClientCAFile      string
+	HTTP3                bool
+	HTTP3Addr            string
+	HTTP3Allow0RTT       bool
+	H2C                  bool
+}
+
+// ListenAddr is a single address to accept connections on. Network is one of
+// "tcp", "tcp4", "tcp6" or "unix".
+type ListenAddr struct {
+	Network string
+	Address string
+}
+
+// String formats the address the way it is written in the configuration.
+func (l ListenAddr) String() string {
+	if l.Network == "tcp" {
+		return l.Address
+	}
+
+	return l.Network + "://" + l.Address
+}
+
+// TLSListenAddrs returns the addresses serving TLS: TLSAddrs when set, Addrs otherwise.
+func (c ServerConfig) TLSListenAddrs() []ListenAddr {
+	if len(c.TLSAddrs) > 0 {
+		return c.TLSAddrs
+	}
+
+	return c.Addrs
+}
+
+// TLSEnabled reports whether the server terminates TLS itself, either with a
+// certificate pair from disk or with ACME-issued certificates.
+func (c ServerConfig) TLSEnabled() bool {
+	return (c.TLSCertFile != "" && c.TLSKeyFile != "") || c.ACMEEnabled()
+}
+
+// ACMEEnabled reports whether certificates are obtained automatically via ACME.
+func (c ServerConfig) ACMEEnabled() bool {
+	return len(c.ACMEDomains) > 0
 }
 
 // ProxyConfig governs how proxy headers are trusted.
 type ProxyConfig struct {
-	TrustForwarded bool
-	TrustedSubnets []netip.Prefix
+	TrustForwarded        bool
+	ClientIPHeaders       []string
+	ClientIPStrategy      string
+	TrustedHops           int
+	TrustedSubnets        []netip.Prefix
+	TrustedSubnetFiles    []string
+	TrustedSubnetsRefresh time.Duration
+	TrustUnixSockets      bool
+	Presets               []ClientIPProvider
+	CustomIPHeaders       []ClientIPProvider
+	TLSHeaders            UpstreamTLSHeaders
+}
+
+// SubnetsRestricted reports whether proxy headers are only trusted from listed subnets.
+func (c ProxyConfig) SubnetsRestricted() bool {
+	return len(c.TrustedSubnets) > 0 || len(c.TrustedSubnetFiles) > 0
+}
+
+// Providers returns the provider presets followed by the custom client IP headers.
+func (c ProxyConfig) Providers() []ClientIPProvider {
+	return slices.Concat(c.Presets, c.CustomIPHeaders)
+}
+
+// ClientIPProvider is a CDN or proxy that passes the client IP in a header of its
+// own. The header is only honored for requests coming from the ranges listed in File.
+type ClientIPProvider struct {
+	// Name is the preset name, or the header for custom headers.
+	Name   string
+	Header string
+	// Hops is the position of the client IP from the right when Header lists
+	// several addresses; 0 means it holds a single address.
+	Hops int
+	File string
+}
+
+// providerPresets maps preset names to the header each provider sets.
+var providerPresets = map[string]ClientIPProvider{
+	"akamai":     {Header: "True-Client-IP"},
+	"cloudflare": {Header: "CF-Connecting-IP"},
+	"fastly":     {Header: "Fastly-Client-IP"},
+	"fly":        {Header: "Fly-Client-IP"},
+	// Google Cloud load balancers append the client address and their own to
+	// X-Forwarded-For.
+	"google": {Header: HeaderXForwardedFor, Hops: 2}, //nolint:mnd // Client and load balancer.
+}
+
+// UpstreamTLSHeaders names the headers a TLS-terminating proxy uses to pass on
+// details of the client's TLS session. Empty names are not consulted.
+type UpstreamTLSHeaders struct {
+	Version             string
+	CipherSuite         string
+	ServerName          string
+	ALPN                string
+	ClientCert          string
+	ClientVerify        string
+	CloudFrontViewerTLS string
+}
+
+// Enabled reports whether any upstream TLS header is configured.
+func (h UpstreamTLSHeaders) Enabled() bool {
+	return h != UpstreamTLSHeaders{}
 }
 
 // ResolverConfig tunes reverse-DNS lookups.
 type ResolverConfig struct {
 	EnableReverseDNS bool
 	LookupTimeout    time.Duration
+	// ForwardTimeout bounds the lookups confirming the PTR names, which start
+	// once LookupTimeout has given the names.
+	ForwardTimeout time.Duration
 }
 
 // MetadataConfig toggles extra response fields.
@@ -59,6 +215,7 @@ type MetadataConfig struct {
 	IncludeTimestamp         bool
 	IncludeConnection        bool
 	IncludeTLS               bool
+	IncludeClientCertificate bool
 	IncludeClientPreferences bool
 	IncludeOriginContext     bool
 	IncludeClientHints       bool
@@ -66,6 +223,13 @@ type MetadataConfig struct {
 	IncludeRequestHeaders    bool
 }
 
+// EnrichmentConfig names the local databases used to describe the client IP.
+type EnrichmentConfig struct {
+	GeoIPDatabase    string
+	ASNDatabase      string
+	DBReloadInterval time.Duration
+}
+
 // LoggingConfig customizes application logging.
 type LoggingConfig struct {
 	Level  slog.Level
@@ -76,33 +240,52 @@ type LoggingConfig struct {
 func Default() Config {
 	return Config{
 		Server: ServerConfig{
-			Addr:              ":8080",
-			ReadTimeout:       defaultReadTimeout,
-			WriteTimeout:      defaultWriteTimeout,
-			ReadHeaderTimeout: defaultReadHeaderTimeout,
-			IdleTimeout:       defaultIdleTimeout,
-			MaxHeaderBytes:    defaultMaxHeaderBytes,
-			ShutdownTimeout:   defaultShutdownTimeout,
+			Addrs:                []ListenAddr{{Network: "tcp", Address: ":8080"}},
+			ReadTimeout:          defaultReadTimeout,
+			WriteTimeout:         defaultWriteTimeout,
+			ReadHeaderTimeout:    defaultReadHeaderTimeout,
+			IdleTimeout:          defaultIdleTimeout,
+			MaxHeaderBytes:       defaultMaxHeaderBytes,
+			ShutdownTimeout:      defaultShutdownTimeout,
+			ProxyProtocol:        false,
+			UnixSocketUID:        -1,
+			UnixSocketGID:        -1,
+			TLSReloadInterval:    defaultTLSReloadInterval,
+			ConfigReloadInterval: 0,
+			ACMEDirectoryURL:     defaultACMEDirectoryURL,
+			TLSClientAuth:        tls.NoClientCert,
+			HTTP3:                false,
+			HTTP3Allow0RTT:       false,
+			H2C:                  false,
 		},
 		Proxy: ProxyConfig{
-			TrustForwarded: false,
-			TrustedSubnets: nil,
+			TrustForwarded:        false,
+			ClientIPHeaders:       []string{HeaderXForwardedFor, HeaderXRealIP, HeaderForwarded},
+			ClientIPStrategy:      StrategyRightmost,
+			TrustedHops:           0,
+			TrustedSubnets:        nil,
+			TrustedSubnetsRefresh: defaultSubnetRefresh,
 		},
 		Resolver: ResolverConfig{
 			EnableReverseDNS: true,
 			LookupTimeout:    defaultLookupTimeout,
+			ForwardTimeout:   defaultForwardTimeout,
 		},
 		Metadata: MetadataConfig{
 			IncludeUserAgent:         true,
 			IncludeTimestamp:         true,
 			IncludeConnection:        true,
 			IncludeTLS:               true,
+			IncludeClientCertificate: true,
 			IncludeClientPreferences: true,
 			IncludeOriginContext:     true,
 			IncludeClientHints:       true,
 			IncludeProxyDetails:      false,
 			IncludeRequestHeaders:    false,
 		},
+		Enrichment: EnrichmentConfig{
+			DBReloadInterval: defaultDBReloadInterval,
+		},
 		Logging: LoggingConfig{
 			Level:  slog.LevelInfo,
 			Format: "text",
@@ -110,215 +293,428 @@ func Default() Config {
 	}
 }
 
-// Load reads configuration from environment variables.
-func Load() (Config, error) {
+// Load reads configuration from the file at path, if any, and then from environment
+// variables, which take precedence over file values. An empty path falls back to
+// IPD_CONFIG.
+func Load(path string) (Config, error) {
+	return load(path, nil)
+}
+
+// load applies, in order of increasing precedence, the defaults, the configuration
+// file, environment variables and command-line flags keyed by variable name.
+func load(path string, flags map[string]string) (Config, error) {
 	cfg := Default()
+	origin := origins{values: make(map[string]string)}
 
-	if v := strings.TrimSpace(os.Getenv("IPD_ADDR")); v != "" {
-		cfg.Server.Addr = v
-	}
+	if path = filePath(path); path != "" {
+		origin.file = true
 
-	if v := os.Getenv("IPD_READ_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_READ_TIMEOUT: %w", err)
+		if err := loadFile(&cfg, path, origin); err != nil {
+			return Config{}, err
 		}
+	}
 
-		cfg.Server.ReadTimeout = d
+	for _, opt := range options {
+		if v := strings.TrimSpace(os.Getenv(opt.env)); v != "" {
+			if err := opt.set(&cfg, v); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", opt.env, err)
+			}
+
+			origin.values[opt.env] = opt.env
+		}
 	}
 
-	if v := os.Getenv("IPD_WRITE_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_WRITE_TIMEOUT: %w", err)
+	for _, opt := range options {
+		if v := strings.TrimSpace(flags[opt.env]); v != "" {
+			if err := opt.set(&cfg, v); err != nil {
+				return Config{}, fmt.Errorf("invalid --%s: %w", opt.flag(), err)
+			}
+
+			origin.values[opt.env] = "--" + opt.flag()
 		}
+	}
 
-		cfg.Server.WriteTimeout = d
+	if err := cfg.validate(origin); err != nil {
+		return Config{}, err
 	}
 
-	if v := os.Getenv("IPD_READ_HEADER_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_READ_HEADER_TIMEOUT: %w", err)
-		}
+	cfg.Warnings = cfg.warnings(origin)
 
-		cfg.Server.ReadHeaderTimeout = d
+	return cfg, nil
+}
+
+// filePath returns the configuration file to read: path, or IPD_CONFIG when path is empty.
+func filePath(path string) string {
+	if path != "" {
+		return path
 	}
 
-	if v := os.Getenv("IPD_IDLE_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_IDLE_TIMEOUT: %w", err)
-		}
+	return strings.TrimSpace(os.Getenv("IPD_CONFIG"))
+}
 
-		cfg.Server.IdleTimeout = d
+// origins records where options were set, keyed by variable name, so that
+// validation errors name settings the way they were given.
+type origins struct {
+	// file is set when a configuration file is in use.
+	file   bool
+	values map[string]string
+}
+
+// name describes the option with the given variable: the flag, the variable or the
+// file key and location it was set by. Options that were not set are named by their
+// file key when a configuration file is in use and by their variable otherwise.
+func (o origins) name(env string) string {
+	if origin, ok := o.values[env]; ok {
+		return origin
 	}
 
-	if v := os.Getenv("IPD_MAX_HEADER_BYTES"); v != "" {
-		n, err := strconv.Atoi(v)
-		if err != nil || n <= 0 {
-			return Config{}, fmt.Errorf("invalid IPD_MAX_HEADER_BYTES: %s", v)
+	if o.file {
+		for _, opt := range options {
+			if opt.env == env {
+				return opt.key()
+			}
 		}
+	}
+
+	return env
+}
 
-		cfg.Server.MaxHeaderBytes = n
+// warnings returns messages about settings that are valid but may not do what was
+// meant.
+func (c Config) warnings(origin origins) []string {
+	var warnings []string
+
+	// Earlier releases always took the leftmost address, so deployments behind
+	// several proxies see a different client IP after upgrading.
+	if _, set := origin.values["IPD_CLIENT_IP_STRATEGY"]; !set && c.Proxy.SubnetsRestricted() {
+		warnings = append(warnings, fmt.Sprintf(
+			"%s is not set and defaults to %s, which skips the trusted proxies from the right instead of taking "+
+				"the leftmost address like earlier releases; set it to %s to keep the old behavior",
+			origin.name("IPD_CLIENT_IP_STRATEGY"), StrategyRightmost, StrategyLeftmost))
 	}
 
-	if v := os.Getenv("IPD_SHUTDOWN_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_SHUTDOWN_TIMEOUT: %w", err)
-		}
+	return warnings
+}
+
+// validate checks combinations of settings that are invalid together.
+func (c Config) validate(origin origins) error {
+	name := origin.name
+	tlsSources := fmt.Sprintf("%s and %s or %s", name("IPD_TLS_CERT"), name("IPD_TLS_KEY"), name("IPD_ACME_DOMAINS"))
 
-		cfg.Server.ShutdownTimeout = d
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		return fmt.Errorf("%s and %s must be set together", name("IPD_TLS_CERT"), name("IPD_TLS_KEY"))
 	}
 
-	if v := os.Getenv("IPD_TRUST_FORWARDED"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_TRUST_FORWARDED: %w", err)
-		}
+	if c.Server.TLSClientAuth >= tls.VerifyClientCertIfGiven && c.Server.TLSClientCAFile == "" {
+		return fmt.Errorf("%s verification modes require %s", name("IPD_TLS_CLIENT_AUTH"), name("IPD_TLS_CLIENT_CA"))
+	}
 
-		cfg.Proxy.TrustForwarded = b
+	if c.Server.ACMEEnabled() && c.Server.TLSCertFile != "" {
+		return fmt.Errorf("%s cannot be combined with %s and %s",
+			name("IPD_ACME_DOMAINS"), name("IPD_TLS_CERT"), name("IPD_TLS_KEY"))
 	}
 
-	if v := os.Getenv("IPD_TRUSTED_SUBNETS"); v != "" {
-		entries := strings.Split(v, ",")
-		cfg.Proxy.TrustedSubnets = nil
+	if len(c.Server.TLSAddrs) > 0 && !c.Server.TLSEnabled() {
+		return fmt.Errorf("%s requires %s", name("IPD_TLS_ADDR"), tlsSources)
+	}
 
-		for _, raw := range entries {
-			trimmed := strings.TrimSpace(raw)
-			if trimmed == "" {
-				continue
-			}
+	if c.Server.HTTP3 && !c.Server.TLSEnabled() {
+		return fmt.Errorf("%s requires %s", name("IPD_HTTP3"), tlsSources)
+	}
 
-			prefix, err := netip.ParsePrefix(trimmed)
-			if err != nil {
-				return Config{}, fmt.Errorf("invalid CIDR in IPD_TRUSTED_SUBNETS: %w", err)
-			}
+	if c.Server.TLSClientAuth != tls.NoClientCert && !c.Server.TLSEnabled() {
+		return fmt.Errorf("%s requires %s", name("IPD_TLS_CLIENT_AUTH"), tlsSources)
+	}
+
+	if c.Server.TLSClientCAFile != "" && !c.Server.TLSEnabled() {
+		return fmt.Errorf("%s requires %s", name("IPD_TLS_CLIENT_CA"), tlsSources)
+	}
+
+	if c.Server.HTTP3 && c.Server.HTTP3Addr == "" && !slices.ContainsFunc(c.Server.TLSListenAddrs(), func(l ListenAddr) bool {
+		return l.Network != "unix"
+	}) {
+		return fmt.Errorf("%s without %s requires a TCP TLS listener", name("IPD_HTTP3"), name("IPD_HTTP3_ADDR"))
+	}
 
-			cfg.Proxy.TrustedSubnets = append(cfg.Proxy.TrustedSubnets, prefix)
+	if c.Proxy.ClientIPStrategy == StrategyHops && c.Proxy.TrustedHops == 0 {
+		return fmt.Errorf("%s=hops requires %s", name("IPD_CLIENT_IP_STRATEGY"), name("IPD_TRUSTED_HOPS"))
+	}
+
+	return nil
+}
+
+func parseList(value string) []string {
+	var items []string
+
+	for _, raw := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(raw); trimmed != "" {
+			items = append(items, trimmed)
 		}
 	}
 
-	if v := os.Getenv("IPD_RESOLVE_PTR"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_RESOLVE_PTR: %w", err)
+	return items
+}
+
+// parseListenAddrs parses comma-separated listen addresses. A bare address means TCP;
+// other networks are written as "tcp4://0.0.0.0:8080", "tcp6://[::]:8080" or
+// "unix:///run/ip-detect.sock".
+func parseListenAddrs(value string) ([]ListenAddr, error) {
+	var addrs []ListenAddr
+
+	for _, item := range parseList(value) {
+		network, address, ok := strings.Cut(item, "://")
+		if !ok {
+			network, address = "tcp", item
 		}
 
-		cfg.Resolver.EnableReverseDNS = b
-	}
+		switch network {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return nil, fmt.Errorf("unsupported network %q in %q", network, item)
+		}
 
-	if v := os.Getenv("IPD_RESOLVE_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_RESOLVE_TIMEOUT: %w", err)
+		if address == "" {
+			return nil, fmt.Errorf("missing address in %q", item)
 		}
 
-		cfg.Resolver.LookupTimeout = d
+		addrs = append(addrs, ListenAddr{Network: network, Address: address})
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_UA"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_UA: %w", err)
-		}
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses given")
+	}
+
+	return addrs, nil
+}
+
+// parseOwner resolves "user[:group]" given as names or numeric IDs. The group
+// defaults to the user's primary group.
+func parseOwner(value string) (int, int, error) {
+	userName, groupName, hasGroup := strings.Cut(value, ":")
+
+	u, err := lookupUser(userName)
+	if err != nil {
+		return 0, 0, err
+	}
 
-		cfg.Metadata.IncludeUserAgent = b
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("user %q has non-numeric uid %q", userName, u.Uid)
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_TS"); v != "" {
-		b, err := strconv.ParseBool(v)
+	gidValue := u.Gid
+	if hasGroup {
+		g, err := lookupGroup(groupName)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_TS: %w", err)
+			return 0, 0, err
 		}
 
-		cfg.Metadata.IncludeTimestamp = b
+		gidValue = g.Gid
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_CONNECTION"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_CONNECTION: %w", err)
+	gid, err := strconv.Atoi(gidValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("group of %q has non-numeric gid %q", value, gidValue)
+	}
+
+	return uid, gid, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		if u, err := user.LookupId(name); err == nil {
+			return u, nil
 		}
 
-		cfg.Metadata.IncludeConnection = b
+		// Numeric IDs need not exist in the user database.
+		return &user.User{Uid: name, Gid: "-1"}, nil
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_TLS"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_TLS: %w", err)
-		}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup user: %w", err)
+	}
+
+	return u, nil
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return &user.Group{Gid: name}, nil
+	}
 
-		cfg.Metadata.IncludeTLS = b
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup group: %w", err)
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_PREFERENCES"); v != "" {
-		b, err := strconv.ParseBool(v)
+	return g, nil
+}
+
+func parsePrefixList(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, raw := range strings.Split(value, ",") {
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" {
+			continue
+		}
+
+		prefix, err := subnets.ParsePrefix(trimmed)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_PREFERENCES: %w", err)
+			return nil, err //nolint:wrapcheck // Wrapped with the option name by the caller.
 		}
 
-		cfg.Metadata.IncludeClientPreferences = b
+		prefixes = append(prefixes, prefix)
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_ORIGIN"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_ORIGIN: %w", err)
+	return prefixes, nil
+}
+
+// parseClientIPHeaders parses a comma-separated list of client IP headers in order of
+// preference, normalizing their names.
+func parseClientIPHeaders(value string) ([]string, error) {
+	var headers []string
+
+	for _, item := range parseList(value) {
+		var header string
+
+		for _, known := range []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP} {
+			if strings.EqualFold(item, known) {
+				header = known
+			}
 		}
 
-		cfg.Metadata.IncludeOriginContext = b
-	}
+		if header == "" {
+			return nil, fmt.Errorf("unsupported header %q, expected %s, %s or %s",
+				item, HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP)
+		}
 
-	if v := os.Getenv("IPD_INCLUDE_CLIENT_HINTS"); v != "" {
-		b, err := strconv.ParseBool(v)
-		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_CLIENT_HINTS: %w", err)
+		if slices.Contains(headers, header) {
+			return nil, fmt.Errorf("header %q listed twice", item)
 		}
 
-		cfg.Metadata.IncludeClientHints = b
+		headers = append(headers, header)
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_PROXY"); v != "" {
-		b, err := strconv.ParseBool(v)
+	if len(headers) == 0 {
+		return nil, errors.New("no headers given")
+	}
+
+	return headers, nil
+}
+
+// parsePresets parses "name=/path/to/ranges" pairs naming provider presets and the
+// files listing their source ranges.
+func parsePresets(value string) ([]ClientIPProvider, error) {
+	var providers []ClientIPProvider
+
+	for _, item := range parseList(value) {
+		name, file, err := parseProviderPair(item)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_PROXY: %w", err)
+			return nil, err
+		}
+
+		name = strings.ToLower(name)
+
+		provider, ok := providerPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q, expected one of %s",
+				name, strings.Join(slices.Sorted(maps.Keys(providerPresets)), ", "))
 		}
 
-		cfg.Metadata.IncludeProxyDetails = b
+		provider.Name = name
+		provider.File = file
+		providers = append(providers, provider)
 	}
 
-	if v := os.Getenv("IPD_INCLUDE_HEADERS"); v != "" {
-		b, err := strconv.ParseBool(v)
+	return providers, nil
+}
+
+// parseCustomIPHeaders parses "Header-Name=/path/to/ranges" pairs naming headers
+// that hold a single client address and the files listing the proxies that set them.
+func parseCustomIPHeaders(value string) ([]ClientIPProvider, error) {
+	var providers []ClientIPProvider
+
+	for _, item := range parseList(value) {
+		header, file, err := parseProviderPair(item)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid IPD_INCLUDE_HEADERS: %w", err)
+			return nil, err
+		}
+
+		if strings.ContainsAny(header, " \t:") {
+			return nil, fmt.Errorf("invalid header name %q", header)
 		}
 
-		cfg.Metadata.IncludeRequestHeaders = b
+		providers = append(providers, ClientIPProvider{Name: header, Header: header, File: file})
 	}
 
-	if v := strings.TrimSpace(os.Getenv("IPD_LOG_FORMAT")); v != "" {
-		v = strings.ToLower(v)
-		switch v {
-		case "text", "json":
-			cfg.Logging.Format = v
-		default:
-			return Config{}, fmt.Errorf("invalid IPD_LOG_FORMAT: %s", v)
-		}
+	return providers, nil
+}
+
+func parseProviderPair(item string) (string, string, error) {
+	name, file, ok := strings.Cut(item, "=")
+	name = strings.TrimSpace(name)
+	file = strings.TrimSpace(file)
+
+	if !ok || name == "" || file == "" {
+		return "", "", fmt.Errorf("expected name=/path/to/ranges, got %q", item)
 	}
 
-	if v := strings.TrimSpace(os.Getenv("IPD_LOG_LEVEL")); v != "" {
-		level, err := parseLogLevel(v)
-		if err != nil {
-			return Config{}, err
+	return name, file, nil
+}
+
+// parseUpstreamTLSHeaders parses "field=Header-Name" pairs separated by commas.
+func parseUpstreamTLSHeaders(value string) (UpstreamTLSHeaders, error) {
+	var headers UpstreamTLSHeaders
+
+	for _, item := range parseList(value) {
+		field, header, ok := strings.Cut(item, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		header = strings.TrimSpace(header)
+
+		if !ok || header == "" {
+			return UpstreamTLSHeaders{}, fmt.Errorf("expected field=Header-Name, got %q", item)
 		}
 
-		cfg.Logging.Level = level
+		switch field {
+		case "version":
+			headers.Version = header
+		case "cipher":
+			headers.CipherSuite = header
+		case "server_name":
+			headers.ServerName = header
+		case "alpn":
+			headers.ALPN = header
+		case "client_cert":
+			headers.ClientCert = header
+		case "client_verify":
+			headers.ClientVerify = header
+		case "cloudfront_viewer_tls":
+			headers.CloudFrontViewerTLS = header
+		default:
+			return UpstreamTLSHeaders{}, fmt.Errorf("unknown field %q", field)
+		}
 	}
 
-	return cfg, nil
+	return headers, nil
+}
+
+func parseClientAuth(value string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(value) {
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify_if_given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "verify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown mode %q", value)
+	}
 }
 
 func parseLogLevel(value string) (slog.Level, error) {
@@ -332,6 +728,6 @@ func parseLogLevel(value string) (slog.Level, error) {
 	case "error":
 		return slog.LevelError, nil
 	default:
-		return slog.LevelInfo, fmt.Errorf("invalid IPD_LOG_LEVEL: %s", value)
+		return slog.LevelInfo, fmt.Errorf("unknown level %q", value)
 	}
 }
@@ -0,0 +1,22 @@
+package config
+
+// Change describes an option whose value differs between two configurations.
+type Change struct {
+	Section string
+	Key     string
+	Old     string
+	New     string
+}
+
+// Diff lists the options that differ between old and updated, in option order.
+func Diff(old, updated Config) []Change {
+	var changes []Change
+
+	for _, opt := range options {
+		if before, after := opt.get(old), opt.get(updated); before != after {
+			changes = append(changes, Change{Section: opt.section, Key: opt.key(), Old: before, New: after})
+		}
+	}
+
+	return changes
+}
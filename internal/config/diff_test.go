@@ -0,0 +1,28 @@
+package config
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := Default()
+
+	updated := Default()
+	updated.Proxy.TrustedSubnets = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	updated.Metadata.IncludeUserAgent = false
+
+	want := []Change{
+		{Section: "proxy", Key: "proxy.trusted_subnets", Old: "", New: "10.0.0.0/8"},
+		{Section: "metadata", Key: "metadata.include_ua", Old: "true", New: "false"},
+	}
+
+	if got := Diff(old, updated); !slices.Equal(got, want) {
+		t.Fatalf("unexpected diff: %+v", got)
+	}
+
+	if got := Diff(old, Default()); len(got) != 0 {
+		t.Fatalf("expected no changes, got %+v", got)
+	}
+}
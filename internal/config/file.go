@@ -0,0 +1,375 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+
+	"git.skobk.in/skobkin/ip-detect/internal/fileerr"
+)
+
+var (
+	errUnsupportedFormat = errors.New("unsupported file format, expected .yaml, .yml or .toml")
+	errArrayTable        = errors.New("arrays of tables are not supported")
+	errNestedValue       = errors.New("expected a scalar, list or map of scalars")
+	errEmptyValue        = errors.New("a value is required")
+)
+
+// fileSetting is a single option value read from a configuration file. Lists are
+// joined with commas and maps written as "key=value" pairs, matching the format of
+// the corresponding environment variable. List options may also be written as a map
+// of labels to values or lists, e.g. trusted subnets grouped by network; the labels
+// only document the file.
+type fileSetting struct {
+	key   string
+	value string
+	line  int
+}
+
+// loadFile applies the settings from a YAML or TOML configuration file to cfg and
+// records their location in origin. Errors name the file, the line and, where known,
+// the key.
+func loadFile(cfg *Config, path string, origin origins) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var settings []fileSetting
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		settings, err = parseYAML(path, data)
+	case ".toml":
+		settings, err = parseTOML(path, data)
+	default:
+		return fileerr.Wrap(errUnsupportedFormat, path, 0)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range settings {
+		opt, ok := lookupOption(setting.key)
+		if !ok {
+			return fileerr.Wrap(fmt.Errorf("unknown key %q", setting.key), path, setting.line)
+		}
+
+		// Empty values clear options that may be empty, e.g. lists; the rest
+		// reject them rather than silently keep their value.
+		if err := opt.set(cfg, setting.value); err != nil {
+			if setting.value == "" {
+				return fileerr.Wrap(fmt.Errorf("%s: %w", setting.key, errEmptyValue), path, setting.line)
+			}
+
+			return fileerr.Wrap(fmt.Errorf("invalid %s: %w", setting.key, err), path, setting.line)
+		}
+
+		origin.values[opt.env] = fmt.Sprintf("%s (%s:%d)", setting.key, path, setting.line)
+	}
+
+	return nil
+}
+
+func parseYAML(path string, data []byte) ([]fileSetting, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fileerr.Wrap(err, path, 0)
+	}
+
+	// An empty document has no content.
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fileerr.Wrap(errors.New("expected a map of sections"), path, root.Line)
+	}
+
+	var settings []fileSetting
+
+	err := walkYAML(path, root, "", &settings)
+
+	return settings, err
+}
+
+func walkYAML(path string, node *yaml.Node, prefix string, settings *[]fileSetting) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], resolveYAMLAlias(node.Content[i+1])
+		key := joinKey(prefix, keyNode.Value)
+
+		if valueNode.Kind == yaml.MappingNode && !isOptionKey(key) {
+			if err := walkYAML(path, valueNode, key, settings); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		value, err := yamlValue(valueNode, keyKind(key))
+		if err != nil {
+			return fileerr.Wrap(fmt.Errorf("%s: %w", key, err), path, valueNode.Line)
+		}
+
+		*settings = append(*settings, fileSetting{key: key, value: value, line: keyNode.Line})
+	}
+
+	return nil
+}
+
+func yamlValue(node *yaml.Node, kind optionKind) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+
+		for _, item := range node.Content {
+			item = resolveYAMLAlias(item)
+			if item.Kind != yaml.ScalarNode {
+				return "", errNestedValue
+			}
+
+			items = append(items, item.Value)
+		}
+
+		return strings.Join(items, ","), nil
+	case yaml.MappingNode:
+		if kind == listKind {
+			return yamlLabeledList(node)
+		}
+
+		pairs := make([]string, 0, len(node.Content)/2)
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := resolveYAMLAlias(node.Content[i+1])
+			if value.Kind != yaml.ScalarNode {
+				return "", errNestedValue
+			}
+
+			pairs = append(pairs, node.Content[i].Value+"="+value.Value)
+		}
+
+		return strings.Join(pairs, ","), nil
+	default:
+		return "", errNestedValue
+	}
+}
+
+// yamlLabeledList joins the values of a map of labels to scalars or lists.
+func yamlLabeledList(node *yaml.Node) (string, error) {
+	var items []string
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := resolveYAMLAlias(node.Content[i+1])
+		if value.Kind != yaml.ScalarNode && value.Kind != yaml.SequenceNode {
+			return "", errNestedValue
+		}
+
+		item, err := yamlValue(value, listKind)
+		if err != nil {
+			return "", err
+		}
+
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return strings.Join(items, ","), nil
+}
+
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	return node
+}
+
+func parseTOML(path string, data []byte) ([]fileSetting, error) {
+	var (
+		parser   unstable.Parser
+		table    []string
+		settings []fileSetting
+	)
+
+	parser.Reset(data)
+
+	for parser.NextExpression() {
+		expr := parser.Expression()
+		line := tomlLine(&parser, expr.Key())
+
+		switch expr.Kind {
+		case unstable.Table:
+			table = tomlKey(expr.Key())
+		case unstable.ArrayTable:
+			return nil, fileerr.Wrap(errArrayTable, path, line)
+		case unstable.KeyValue:
+			key := joinKey(strings.Join(table, "."), strings.Join(tomlKey(expr.Key()), "."))
+
+			if err := walkTOML(path, expr.Value(), key, line, &settings); err != nil {
+				return nil, err
+			}
+		default:
+		}
+	}
+
+	if err := parser.Error(); err != nil {
+		var parseErr *unstable.ParserError
+		if errors.As(err, &parseErr) && len(parseErr.Highlight) > 0 {
+			line := parser.Shape(parser.Range(parseErr.Highlight)).Start.Line
+
+			return nil, fileerr.Wrap(err, path, line)
+		}
+
+		return nil, fileerr.Wrap(err, path, 0)
+	}
+
+	return settings, nil
+}
+
+func walkTOML(path string, node *unstable.Node, key string, line int, settings *[]fileSetting) error {
+	if node.Kind == unstable.InlineTable && !isOptionKey(key) {
+		for it := node.Children(); it.Next(); {
+			child := it.Node()
+
+			err := walkTOML(path, child.Value(), joinKey(key, strings.Join(tomlKey(child.Key()), ".")), line, settings)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	value, err := tomlValue(node, keyKind(key))
+	if err != nil {
+		return fileerr.Wrap(fmt.Errorf("%s: %w", key, err), path, line)
+	}
+
+	*settings = append(*settings, fileSetting{key: key, value: value, line: line})
+
+	return nil
+}
+
+func tomlValue(node *unstable.Node, kind optionKind) (string, error) {
+	switch node.Kind {
+	case unstable.Array:
+		var items []string
+
+		for it := node.Children(); it.Next(); {
+			item := it.Node()
+			if !isTOMLScalar(item) {
+				return "", errNestedValue
+			}
+
+			items = append(items, string(item.Data))
+		}
+
+		return strings.Join(items, ","), nil
+	case unstable.InlineTable:
+		if kind == listKind {
+			return tomlLabeledList(node)
+		}
+
+		var pairs []string
+
+		for it := node.Children(); it.Next(); {
+			pair := it.Node()
+			if !isTOMLScalar(pair.Value()) {
+				return "", errNestedValue
+			}
+
+			pairs = append(pairs, strings.Join(tomlKey(pair.Key()), ".")+"="+string(pair.Value().Data))
+		}
+
+		return strings.Join(pairs, ","), nil
+	default:
+		if !isTOMLScalar(node) {
+			return "", errNestedValue
+		}
+
+		return string(node.Data), nil
+	}
+}
+
+// tomlLabeledList joins the values of an inline table of labels to scalars or arrays.
+func tomlLabeledList(node *unstable.Node) (string, error) {
+	var items []string
+
+	for it := node.Children(); it.Next(); {
+		value := it.Node().Value()
+		if value.Kind == unstable.InlineTable {
+			return "", errNestedValue
+		}
+
+		item, err := tomlValue(value, listKind)
+		if err != nil {
+			return "", err
+		}
+
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return strings.Join(items, ","), nil
+}
+
+func isTOMLScalar(node *unstable.Node) bool {
+	return node.Kind != unstable.Array && node.Kind != unstable.InlineTable
+}
+
+func tomlKey(it unstable.Iterator) []string {
+	var parts []string
+
+	for it.Next() {
+		parts = append(parts, string(it.Node().Data))
+	}
+
+	return parts
+}
+
+// tomlLine returns the line of the first key part, or zero for keyless expressions.
+func tomlLine(parser *unstable.Parser, it unstable.Iterator) int {
+	if !it.Next() {
+		return 0
+	}
+
+	return parser.Shape(it.Node().Raw).Start.Line
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// keyKind returns the kind of the option named by key; unknown keys are reported
+// later and treated as strings here.
+func keyKind(key string) optionKind {
+	opt, _ := lookupOption(key)
+
+	return opt.kind
+}
+
+// isOptionKey reports whether key names an option, as opposed to a section.
+func isOptionKey(key string) bool {
+	_, ok := lookupOption(key)
+
+	return ok
+}
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  addr:
+    - 127.0.0.1:8080
+    - unix:///run/ip-detect.sock
+  read_timeout: 2s
+  unix_socket_mode: "0660"
+proxy:
+  trust_forwarded: true
+  client_ip_headers: [forwarded, x-real-ip]
+  trusted_subnets: [10.0.0.0/8, "fd00::/8"]
+  provider_presets:
+    Cloudflare: /etc/ip-detect/cloudflare.txt
+  custom_ip_headers: {X-Edge-Client: /etc/ip-detect/edge.txt}
+  upstream_tls_headers:
+    version: X-SSL-Protocol
+    cipher: X-SSL-Cipher
+logging:
+  log_format: json
+`,
+		"config.toml": `
+[server]
+addr = ["127.0.0.1:8080", "unix:///run/ip-detect.sock"]
+read_timeout = "2s"
+unix_socket_mode = 0o660
+
+[proxy]
+trust_forwarded = true
+client_ip_headers = ["forwarded", "x-real-ip"]
+trusted_subnets = ["10.0.0.0/8", "fd00::/8"]
+provider_presets = { Cloudflare = "/etc/ip-detect/cloudflare.txt" }
+custom_ip_headers = { X-Edge-Client = "/etc/ip-detect/edge.txt" }
+upstream_tls_headers = { version = "X-SSL-Protocol", cipher = "X-SSL-Cipher" }
+
+[logging]
+log_format = "json"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeConfigFile(t, name, content))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			wantAddrs := []ListenAddr{
+				{Network: "tcp", Address: "127.0.0.1:8080"},
+				{Network: "unix", Address: "/run/ip-detect.sock"},
+			}
+			if !slices.Equal(cfg.Server.Addrs, wantAddrs) {
+				t.Fatalf("unexpected addrs: %v", cfg.Server.Addrs)
+			}
+
+			if cfg.Server.ReadTimeout != 2*time.Second {
+				t.Fatalf("unexpected read timeout: %v", cfg.Server.ReadTimeout)
+			}
+
+			if cfg.Server.UnixSocketMode != 0o660 {
+				t.Fatalf("unexpected socket mode: %v", cfg.Server.UnixSocketMode)
+			}
+
+			wantSubnets := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+			if !cfg.Proxy.TrustForwarded || !slices.Equal(cfg.Proxy.TrustedSubnets, wantSubnets) {
+				t.Fatalf("unexpected proxy config: %+v", cfg.Proxy)
+			}
+
+			if !slices.Equal(cfg.Proxy.ClientIPHeaders, []string{HeaderForwarded, HeaderXRealIP}) {
+				t.Fatalf("unexpected client IP headers: %v", cfg.Proxy.ClientIPHeaders)
+			}
+
+			wantProviders := []ClientIPProvider{
+				{Name: "cloudflare", Header: "CF-Connecting-IP", File: "/etc/ip-detect/cloudflare.txt"},
+				{Name: "X-Edge-Client", Header: "X-Edge-Client", File: "/etc/ip-detect/edge.txt"},
+			}
+			if !slices.Equal(cfg.Proxy.Providers(), wantProviders) {
+				t.Fatalf("unexpected providers: %+v", cfg.Proxy.Providers())
+			}
+
+			if cfg.Proxy.TLSHeaders.Version != "X-SSL-Protocol" || cfg.Proxy.TLSHeaders.CipherSuite != "X-SSL-Cipher" {
+				t.Fatalf("unexpected upstream TLS headers: %+v", cfg.Proxy.TLSHeaders)
+			}
+
+			if cfg.Logging.Format != "json" {
+				t.Fatalf("unexpected log format: %q", cfg.Logging.Format)
+			}
+
+			// Untouched options keep their defaults.
+			if cfg.Server.WriteTimeout != defaultWriteTimeout {
+				t.Fatalf("unexpected write timeout: %v", cfg.Server.WriteTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadFileEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  read_timeout: 2s\n  write_timeout: 3s\n")
+
+	t.Setenv("IPD_CONFIG", path)
+	t.Setenv("IPD_READ_TIMEOUT", "7s")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Server.ReadTimeout != 7*time.Second {
+		t.Fatalf("expected env to override the file, got %v", cfg.Server.ReadTimeout)
+	}
+
+	if cfg.Server.WriteTimeout != 3*time.Second {
+		t.Fatalf("expected file value, got %v", cfg.Server.WriteTimeout)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{
+			name:    "yaml invalid value",
+			file:    "config.yaml",
+			content: "server:\n  addr: :8080\n  read_timeout: soon\n",
+			want:    "config.yaml:3: invalid server.read_timeout: ",
+		},
+		{
+			name:    "yaml unknown key",
+			file:    "config.yaml",
+			content: "server:\n  addr: :8080\nproxy:\n  trust_forwrded: true\n",
+			want:    `config.yaml:4: unknown key "proxy.trust_forwrded"`,
+		},
+		{
+			name:    "yaml nested value",
+			file:    "config.yml",
+			content: "proxy:\n  trusted_subnets:\n    - [10.0.0.0/8]\n",
+			want:    "config.yml:3: proxy.trusted_subnets: ",
+		},
+		{
+			name:    "yaml nested labeled value",
+			file:    "config.yaml",
+			content: "proxy:\n  trusted_subnets:\n    office:\n      lan: 10.0.0.0/8\n",
+			want:    "config.yaml:3: proxy.trusted_subnets: ",
+		},
+		{
+			name:    "yaml unsupported client IP header",
+			file:    "config.yaml",
+			content: "proxy:\n  client_ip_headers: [X-Forwarded-For, CF-Connecting-IP]\n",
+			want:    `config.yaml:2: invalid proxy.client_ip_headers: unsupported header "CF-Connecting-IP"`,
+		},
+		{
+			name:    "yaml unknown preset",
+			file:    "config.yaml",
+			content: "proxy:\n  provider_presets:\n    cloudfront: /etc/ranges.txt\n",
+			want:    `config.yaml:2: invalid proxy.provider_presets: unknown preset "cloudfront"`,
+		},
+		{
+			name:    "yaml syntax",
+			file:    "config.yaml",
+			content: "server:\n  addr: [\n",
+			want:    "config.yaml: yaml: line 2: ",
+		},
+		{
+			name:    "toml invalid value",
+			file:    "config.toml",
+			content: "[server]\naddr = \":8080\"\n\n[metadata]\ninclude_tls = \"maybe\"\n",
+			want:    "config.toml:5: invalid metadata.include_tls: ",
+		},
+		{
+			name:    "toml unknown key",
+			file:    "config.toml",
+			content: "[server]\nlisten = \":8080\"\n",
+			want:    `config.toml:2: unknown key "server.listen"`,
+		},
+		{
+			name:    "toml syntax",
+			file:    "config.toml",
+			content: "[server]\naddr = \":8080\"\nread_timeout = \n",
+			want:    "config.toml:3: ",
+		},
+		{
+			name:    "unsupported format",
+			file:    "config.json",
+			content: "{}",
+			want:    "config.json: unsupported file format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file, tt.content)
+
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if want := filepath.Join(filepath.Dir(path), tt.want); !strings.HasPrefix(err.Error(), want) {
+				t.Fatalf("expected error starting with %q, got %q", want, err)
+			}
+		})
+	}
+}
+
+func TestLoadFileValidate(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  addr: :8443\n  tls_cert: /etc/ip-detect/cert.pem\n")
+
+	_, err := Load(path)
+	if want := "server.tls_cert (" + path + ":3) and server.tls_key must be set together"; err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+
+	t.Setenv("IPD_CLIENT_IP_STRATEGY", "hops")
+	t.Setenv("IPD_TLS_KEY", "/etc/ip-detect/key.pem")
+
+	_, err = Load(path)
+	if want := "IPD_CLIENT_IP_STRATEGY=hops requires proxy.trusted_hops"; err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestLoadFileEmptyValues(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  acme_directory_url: \"\"\n  unix_socket_mode:\nproxy:\n  trusted_subnets: \"\"\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Server.ACMEDirectoryURL != "" || cfg.Server.UnixSocketMode != 0 || cfg.Proxy.TrustedSubnets != nil {
+		t.Fatalf("expected empty values to clear the options, got %+v", cfg)
+	}
+
+	path = writeConfigFile(t, "config.toml", "[server]\nh2c = \"\"\n")
+
+	_, err = Load(path)
+	if want := path + ":2: server.h2c: a value is required"; err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestLoadClientAuthRequiresTLS(t *testing.T) {
+	t.Setenv("IPD_TLS_CLIENT_AUTH", "request")
+
+	_, err := Load("")
+	if want := "IPD_TLS_CLIENT_AUTH requires IPD_TLS_CERT and IPD_TLS_KEY or IPD_ACME_DOMAINS"; err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+
+	t.Setenv("IPD_TLS_CLIENT_AUTH", "")
+	t.Setenv("IPD_TLS_CLIENT_CA", "/etc/ip-detect/clients.pem")
+
+	_, err = Load("")
+	if want := "IPD_TLS_CLIENT_CA requires IPD_TLS_CERT and IPD_TLS_KEY or IPD_ACME_DOMAINS"; err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestLoadWarnings(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "proxy:\n  trust_forwarded: true\n  trusted_subnets: [10.0.0.0/8]\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if len(cfg.Warnings) != 1 || !strings.HasPrefix(cfg.Warnings[0], "proxy.client_ip_strategy is not set and defaults to rightmost") {
+		t.Fatalf("expected a warning about the client IP strategy, got %q", cfg.Warnings)
+	}
+
+	t.Setenv("IPD_CLIENT_IP_STRATEGY", "rightmost")
+
+	if cfg, err = Load(path); err != nil || len(cfg.Warnings) != 0 {
+		t.Fatalf("expected no warnings with an explicit strategy, got %q, %v", cfg.Warnings, err)
+	}
+}
+
+func TestLoadFileLabeledLists(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+proxy:
+  trusted_subnets:
+    office: 10.0.0.0/8
+    vpn: [192.168.0.0/16, "fd00::/8"]
+  trusted_subnets_files:
+    internal: /etc/ip-detect/internal.txt
+`,
+		"config.toml": `
+[proxy]
+trusted_subnets = { office = "10.0.0.0/8", vpn = ["192.168.0.0/16", "fd00::/8"] }
+trusted_subnets_files = { internal = "/etc/ip-detect/internal.txt" }
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeConfigFile(t, name, content))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			want := []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("192.168.0.0/16"),
+				netip.MustParsePrefix("fd00::/8"),
+			}
+			if !slices.Equal(cfg.Proxy.TrustedSubnets, want) {
+				t.Fatalf("unexpected trusted subnets: %v", cfg.Proxy.TrustedSubnets)
+			}
+
+			if !slices.Equal(cfg.Proxy.TrustedSubnetFiles, []string{"/etc/ip-detect/internal.txt"}) {
+				t.Fatalf("unexpected trusted subnet files: %v", cfg.Proxy.TrustedSubnetFiles)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import "flag"
+
+// Flags holds the configuration given on the command line.
+type Flags struct {
+	path   string
+	values map[string]string
+}
+
+// BindFlags defines --config and a flag for every option on fs. Flags are named
+// after their environment variable: IPD_READ_TIMEOUT is --read-timeout.
+func BindFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{values: make(map[string]string)}
+
+	fs.StringVar(&f.path, "config", "", "path to a YAML or TOML configuration `file` (default $IPD_CONFIG)")
+
+	for _, opt := range options {
+		fs.Var(&optionFlag{opt: opt, values: f.values}, opt.flag(), opt.usage)
+	}
+
+	return f
+}
+
+// Load reads the configuration like the package-level Load, with flags given on
+// the command line taking precedence over environment variables.
+func (f *Flags) Load() (Config, error) {
+	return load(f.path, f.values)
+}
+
+// Path returns the configuration file in use, if any.
+func (f *Flags) Path() string {
+	return filePath(f.path)
+}
+
+// optionFlag records the raw flag value; it is parsed by Load so that errors
+// are reported in the same way for every source.
+type optionFlag struct {
+	opt    option
+	values map[string]string
+}
+
+func (f *optionFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+
+	return f.values[f.opt.env]
+}
+
+func (f *optionFlag) Set(value string) error {
+	f.values[f.opt.env] = value
+
+	return nil
+}
+
+func (f *optionFlag) IsBoolFlag() bool {
+	return f.opt.kind == boolKind
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlagsPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  read_timeout: 2s\n  write_timeout: 3s\n  idle_timeout: 4s\n")
+
+	t.Setenv("IPD_WRITE_TIMEOUT", "6s")
+	t.Setenv("IPD_IDLE_TIMEOUT", "7s")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := BindFlags(fs)
+
+	if err := fs.Parse([]string{"--config", path, "--idle-timeout", "8s", "--h2c"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cfg, err := flags.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Server.ReadTimeout != 2*time.Second {
+		t.Fatalf("expected file value, got %v", cfg.Server.ReadTimeout)
+	}
+
+	if cfg.Server.WriteTimeout != 6*time.Second {
+		t.Fatalf("expected env to override the file, got %v", cfg.Server.WriteTimeout)
+	}
+
+	if cfg.Server.IdleTimeout != 8*time.Second {
+		t.Fatalf("expected flag to override env, got %v", cfg.Server.IdleTimeout)
+	}
+
+	if !cfg.Server.H2C {
+		t.Fatal("expected boolean flag without a value to enable h2c")
+	}
+}
+
+func TestFlagsInvalidValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	flags := BindFlags(fs)
+
+	if err := fs.Parse([]string{"--max-header-bytes", "-1"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	_, err := flags.Load()
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid --max-header-bytes: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFlagsValidate(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := BindFlags(fs)
+
+	if err := fs.Parse([]string{"--client-ip-strategy", "hops"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if _, err := flags.Load(); err == nil || !strings.Contains(err.Error(), "IPD_TRUSTED_HOPS") {
+		t.Fatalf("expected the hops strategy to require a hop count, got %v", err)
+	}
+
+	if err := fs.Parse([]string{"--trusted-hops", "2"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cfg, err := flags.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Proxy.ClientIPStrategy != StrategyHops || cfg.Proxy.TrustedHops != 2 {
+		t.Fatalf("unexpected proxy config: %+v", cfg.Proxy)
+	}
+}
@@ -0,0 +1,522 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envPrefix = "IPD_"
+
+// optionKind describes the shape of an option value beyond its string form.
+type optionKind int
+
+const (
+	stringKind optionKind = iota
+	boolKind
+	intKind
+	// listKind values are comma-separated lists.
+	listKind
+	// mapKind values are comma-separated key=value pairs.
+	mapKind
+)
+
+// option is a single setting that can be given as an environment variable, a
+// command-line flag or in the configuration file. The flag and file key are
+// derived from the variable name: IPD_READ_TIMEOUT is --read-timeout and
+// server.read_timeout.
+type option struct {
+	section string
+	env     string
+	usage   string
+	kind    optionKind
+	set     func(cfg *Config, value string) error
+	get     func(cfg Config) string
+}
+
+func (o option) name() string {
+	return strings.ToLower(strings.TrimPrefix(o.env, envPrefix))
+}
+
+// key returns the dotted key of the option in the configuration file.
+func (o option) key() string {
+	return o.section + "." + o.name()
+}
+
+// flag returns the name of the command-line flag for the option.
+func (o option) flag() string {
+	return strings.ReplaceAll(o.name(), "_", "-")
+}
+
+// options lists every setting in the order they are applied.
+var options = []option{
+	{
+		section: "server", env: "IPD_ADDR", kind: listKind,
+		usage: "listen addresses: host:port, tcp4://host:port, tcp6://[host]:port or unix:///path.sock",
+		set: func(cfg *Config, v string) error {
+			addrs, err := parseListenAddrs(v)
+			cfg.Server.Addrs = addrs
+
+			return err
+		},
+		get: func(cfg Config) string { return formatListenAddrs(cfg.Server.Addrs) },
+	},
+	durationOption("server", "IPD_READ_TIMEOUT", "HTTP read timeout",
+		func(cfg *Config) *time.Duration { return &cfg.Server.ReadTimeout }),
+	durationOption("server", "IPD_WRITE_TIMEOUT", "HTTP write timeout",
+		func(cfg *Config) *time.Duration { return &cfg.Server.WriteTimeout }),
+	durationOption("server", "IPD_READ_HEADER_TIMEOUT", "timeout for reading request headers",
+		func(cfg *Config) *time.Duration { return &cfg.Server.ReadHeaderTimeout }),
+	durationOption("server", "IPD_IDLE_TIMEOUT", "keep-alive idle timeout",
+		func(cfg *Config) *time.Duration { return &cfg.Server.IdleTimeout }),
+	{
+		section: "server", env: "IPD_MAX_HEADER_BYTES", kind: intKind,
+		usage: "maximum request header size in bytes",
+		set: func(cfg *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("%q is not a positive integer", v)
+			}
+
+			cfg.Server.MaxHeaderBytes = n
+
+			return nil
+		},
+		get: func(cfg Config) string { return strconv.Itoa(cfg.Server.MaxHeaderBytes) },
+	},
+	durationOption("server", "IPD_SHUTDOWN_TIMEOUT", "graceful shutdown timeout",
+		func(cfg *Config) *time.Duration { return &cfg.Server.ShutdownTimeout }),
+	boolOption("server", "IPD_PROXY_PROTOCOL", "accept PROXY protocol v1/v2 headers",
+		func(cfg *Config) *bool { return &cfg.Server.ProxyProtocol }),
+	{
+		section: "server", env: "IPD_PROXY_PROTOCOL_SUBNETS", kind: listKind,
+		usage: "CIDRs allowed to send PROXY protocol headers (empty = any peer)",
+		set: func(cfg *Config, v string) error {
+			prefixes, err := parsePrefixList(v)
+			cfg.Server.ProxyProtocolSubnets = prefixes
+
+			return err
+		},
+		get: func(cfg Config) string { return formatPrefixes(cfg.Server.ProxyProtocolSubnets) },
+	},
+	{
+		section: "server", env: "IPD_TLS_ADDR", kind: listKind,
+		usage: "separate HTTPS listen addresses, same syntax as addr",
+		set: func(cfg *Config, v string) error {
+			if v == "" {
+				cfg.Server.TLSAddrs = nil
+
+				return nil
+			}
+
+			addrs, err := parseListenAddrs(v)
+			cfg.Server.TLSAddrs = addrs
+
+			return err
+		},
+		get: func(cfg Config) string { return formatListenAddrs(cfg.Server.TLSAddrs) },
+	},
+	{
+		section: "server", env: "IPD_UNIX_SOCKET_MODE",
+		usage: "octal file mode for Unix socket listeners, e.g. 0660",
+		set: func(cfg *Config, v string) error {
+			if v == "" {
+				cfg.Server.UnixSocketMode = 0
+
+				return nil
+			}
+
+			// TOML writes octal integers as 0o660, a leading zero being invalid there.
+			digits := strings.TrimPrefix(strings.TrimPrefix(v, "0o"), "0O")
+
+			mode, err := strconv.ParseUint(digits, 8, 32)
+			if err != nil || mode > uint64(os.ModePerm) {
+				return fmt.Errorf("%q is not an octal permission mode", v)
+			}
+
+			cfg.Server.UnixSocketMode = os.FileMode(mode)
+
+			return nil
+		},
+		get: func(cfg Config) string {
+			if cfg.Server.UnixSocketMode == 0 {
+				return ""
+			}
+
+			return fmt.Sprintf("%04o", uint32(cfg.Server.UnixSocketMode))
+		},
+	},
+	{
+		section: "server", env: "IPD_UNIX_SOCKET_OWNER",
+		usage: "user[:group] to own Unix socket listeners",
+		set: func(cfg *Config, v string) error {
+			if v == "" {
+				cfg.Server.UnixSocketUID, cfg.Server.UnixSocketGID = -1, -1
+
+				return nil
+			}
+
+			uid, gid, err := parseOwner(v)
+			if err != nil {
+				return err
+			}
+
+			cfg.Server.UnixSocketUID, cfg.Server.UnixSocketGID = uid, gid
+
+			return nil
+		},
+		get: func(cfg Config) string {
+			return formatOwner(cfg.Server.UnixSocketUID, cfg.Server.UnixSocketGID)
+		},
+	},
+	stringOption("server", "IPD_TLS_CERT", "PEM certificate file",
+		func(cfg *Config) *string { return &cfg.Server.TLSCertFile }),
+	stringOption("server", "IPD_TLS_KEY", "PEM private key file",
+		func(cfg *Config) *string { return &cfg.Server.TLSKeyFile }),
+	{
+		section: "server", env: "IPD_ACME_DOMAINS", kind: listKind,
+		usage: "host names to obtain certificates for via ACME",
+		set: func(cfg *Config, v string) error {
+			cfg.Server.ACMEDomains = parseList(v)
+
+			return nil
+		},
+		get: func(cfg Config) string { return strings.Join(cfg.Server.ACMEDomains, ",") },
+	},
+	stringOption("server", "IPD_ACME_DIRECTORY_URL", "ACME directory URL",
+		func(cfg *Config) *string { return &cfg.Server.ACMEDirectoryURL }),
+	stringOption("server", "IPD_ACME_CACHE_DIR", "directory for the ACME account key and certificates",
+		func(cfg *Config) *string { return &cfg.Server.ACMECacheDir }),
+	stringOption("server", "IPD_ACME_EMAIL", "contact email for the ACME account",
+		func(cfg *Config) *string { return &cfg.Server.ACMEEmail }),
+	stringOption("server", "IPD_ACME_CA_FILE", "extra PEM CA bundle for the ACME directory",
+		func(cfg *Config) *string { return &cfg.Server.ACMECAFile }),
+	{
+		section: "server", env: "IPD_TLS_CLIENT_AUTH",
+		usage: "client certificate mode: none, request, require, verify_if_given or verify",
+		set: func(cfg *Config, v string) error {
+			mode, err := parseClientAuth(v)
+			cfg.Server.TLSClientAuth = mode
+
+			return err
+		},
+		get: func(cfg Config) string { return formatClientAuth(cfg.Server.TLSClientAuth) },
+	},
+	stringOption("server", "IPD_TLS_CLIENT_CA", "PEM CA bundle for client certificates",
+		func(cfg *Config) *string { return &cfg.Server.TLSClientCAFile }),
+	boolOption("server", "IPD_HTTP3", "serve HTTP/3 over QUIC (requires TLS)",
+		func(cfg *Config) *bool { return &cfg.Server.HTTP3 }),
+	stringOption("server", "IPD_HTTP3_ADDR", "UDP address for HTTP/3 (empty = first TCP TLS listener)",
+		func(cfg *Config) *string { return &cfg.Server.HTTP3Addr }),
+	boolOption("server", "IPD_HTTP3_0RTT", "accept QUIC 0-RTT early data",
+		func(cfg *Config) *bool { return &cfg.Server.HTTP3Allow0RTT }),
+	boolOption("server", "IPD_H2C", "accept cleartext HTTP/2 on plain listeners",
+		func(cfg *Config) *bool { return &cfg.Server.H2C }),
+	durationOption("server", "IPD_TLS_RELOAD_INTERVAL", "how often certificate files are checked for changes",
+		func(cfg *Config) *time.Duration { return &cfg.Server.TLSReloadInterval }),
+	durationOption("server", "IPD_CONFIG_RELOAD_INTERVAL", "how often the configuration file is checked for changes (0 = only on SIGHUP)",
+		func(cfg *Config) *time.Duration { return &cfg.Server.ConfigReloadInterval }),
+	boolOption("proxy", "IPD_TRUST_FORWARDED", "honor client IP headers from proxies",
+		func(cfg *Config) *bool { return &cfg.Proxy.TrustForwarded }),
+	{
+		section: "proxy", env: "IPD_CLIENT_IP_HEADERS", kind: listKind,
+		usage: "headers consulted for the client IP, in order of preference: Forwarded, X-Forwarded-For, X-Real-IP",
+		set: func(cfg *Config, v string) error {
+			headers, err := parseClientIPHeaders(v)
+			cfg.Proxy.ClientIPHeaders = headers
+
+			return err
+		},
+		get: func(cfg Config) string { return strings.Join(cfg.Proxy.ClientIPHeaders, ",") },
+	},
+	{
+		section: "proxy", env: "IPD_CLIENT_IP_STRATEGY",
+		usage: "how the client IP is picked from X-Forwarded-For and Forwarded: rightmost, hops or leftmost",
+		set: func(cfg *Config, v string) error {
+			v = strings.ToLower(v)
+			switch v {
+			case StrategyRightmost, StrategyHops, StrategyLeftmost:
+				cfg.Proxy.ClientIPStrategy = v
+			default:
+				return fmt.Errorf("unknown strategy %q", v)
+			}
+
+			return nil
+		},
+		get: func(cfg Config) string { return cfg.Proxy.ClientIPStrategy },
+	},
+	{
+		section: "proxy", env: "IPD_TRUSTED_HOPS", kind: intKind,
+		usage: "number of proxies in front of the server, for the hops strategy",
+		set: func(cfg *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%q is not a non-negative integer", v)
+			}
+
+			cfg.Proxy.TrustedHops = n
+
+			return nil
+		},
+		get: func(cfg Config) string { return strconv.Itoa(cfg.Proxy.TrustedHops) },
+	},
+	{
+		section: "proxy", env: "IPD_TRUSTED_SUBNETS", kind: listKind,
+		usage: "CIDRs required to trust proxy headers (empty = every proxy)",
+		set: func(cfg *Config, v string) error {
+			prefixes, err := parsePrefixList(v)
+			cfg.Proxy.TrustedSubnets = prefixes
+
+			return err
+		},
+		get: func(cfg Config) string { return formatPrefixes(cfg.Proxy.TrustedSubnets) },
+	},
+	{
+		section: "proxy", env: "IPD_TRUSTED_SUBNETS_FILES", kind: listKind,
+		usage: "files with one trusted proxy CIDR per line, refreshed periodically",
+		set: func(cfg *Config, v string) error {
+			cfg.Proxy.TrustedSubnetFiles = parseList(v)
+
+			return nil
+		},
+		get: func(cfg Config) string { return strings.Join(cfg.Proxy.TrustedSubnetFiles, ",") },
+	},
+	durationOption("proxy", "IPD_TRUSTED_SUBNETS_REFRESH", "how often trusted subnet and provider range files are re-read (0 = only on reload)",
+		func(cfg *Config) *time.Duration { return &cfg.Proxy.TrustedSubnetsRefresh }),
+	boolOption("proxy", "IPD_TRUST_UNIX_SOCKETS", "trust proxy headers on Unix socket listeners when trusted subnets are set",
+		func(cfg *Config) *bool { return &cfg.Proxy.TrustUnixSockets }),
+	{
+		section: "proxy", env: "IPD_PROVIDER_PRESETS", kind: mapKind,
+		usage: "preset=/path/to/ranges pairs for CDN client IP headers: akamai, cloudflare, fastly, fly or google",
+		set: func(cfg *Config, v string) error {
+			providers, err := parsePresets(v)
+			cfg.Proxy.Presets = providers
+
+			return err
+		},
+		get: func(cfg Config) string { return formatProviders(cfg.Proxy.Presets) },
+	},
+	{
+		section: "proxy", env: "IPD_CUSTOM_IP_HEADERS", kind: mapKind,
+		usage: "Header-Name=/path/to/ranges pairs for client IP headers set by other proxies",
+		set: func(cfg *Config, v string) error {
+			providers, err := parseCustomIPHeaders(v)
+			cfg.Proxy.CustomIPHeaders = providers
+
+			return err
+		},
+		get: func(cfg Config) string { return formatProviders(cfg.Proxy.CustomIPHeaders) },
+	},
+	{
+		section: "proxy", env: "IPD_UPSTREAM_TLS_HEADERS", kind: mapKind,
+		usage: "field=Header-Name pairs for TLS details from a TLS-terminating proxy",
+		set: func(cfg *Config, v string) error {
+			headers, err := parseUpstreamTLSHeaders(v)
+			cfg.Proxy.TLSHeaders = headers
+
+			return err
+		},
+		get: func(cfg Config) string { return formatUpstreamTLSHeaders(cfg.Proxy.TLSHeaders) },
+	},
+	boolOption("resolver", "IPD_RESOLVE_PTR", "resolve PTR records for the detected IP",
+		func(cfg *Config) *bool { return &cfg.Resolver.EnableReverseDNS }),
+	durationOption("resolver", "IPD_RESOLVE_TIMEOUT", "reverse DNS lookup timeout",
+		func(cfg *Config) *time.Duration { return &cfg.Resolver.LookupTimeout }),
+	durationOption("resolver", "IPD_RESOLVE_FORWARD_TIMEOUT", "timeout of the lookups confirming PTR names",
+		func(cfg *Config) *time.Duration { return &cfg.Resolver.ForwardTimeout }),
+	boolOption("metadata", "IPD_INCLUDE_UA", "include the User-Agent header",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeUserAgent }),
+	boolOption("metadata", "IPD_INCLUDE_TS", "include the current UTC timestamp",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeTimestamp }),
+	boolOption("metadata", "IPD_INCLUDE_CONNECTION", "include connection details",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeConnection }),
+	boolOption("metadata", "IPD_INCLUDE_TLS", "include TLS session details",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeTLS }),
+	boolOption("metadata", "IPD_INCLUDE_CLIENT_CERT", "include the client certificate chain",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeClientCertificate }),
+	boolOption("metadata", "IPD_INCLUDE_PREFERENCES", "include client preference headers",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeClientPreferences }),
+	boolOption("metadata", "IPD_INCLUDE_ORIGIN", "include origin context headers",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeOriginContext }),
+	boolOption("metadata", "IPD_INCLUDE_CLIENT_HINTS", "include User-Agent Client Hints",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeClientHints }),
+	boolOption("metadata", "IPD_INCLUDE_PROXY", "include proxy-related headers",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeProxyDetails }),
+	boolOption("metadata", "IPD_INCLUDE_HEADERS", "include all request headers",
+		func(cfg *Config) *bool { return &cfg.Metadata.IncludeRequestHeaders }),
+	stringOption("enrichment", "IPD_GEOIP_DB", "path to a MaxMind-format City or Country database (.mmdb)",
+		func(cfg *Config) *string { return &cfg.Enrichment.GeoIPDatabase }),
+	stringOption("enrichment", "IPD_ASN_DB", "path to a GeoLite2-ASN database (.mmdb) or an iptoasn-style TSV file (.tsv, .tsv.gz)",
+		func(cfg *Config) *string { return &cfg.Enrichment.ASNDatabase }),
+	durationOption("enrichment", "IPD_DB_RELOAD_INTERVAL", "how often database files are checked for replacement (0 = only on SIGHUP)",
+		func(cfg *Config) *time.Duration { return &cfg.Enrichment.DBReloadInterval }),
+	{
+		section: "logging", env: "IPD_LOG_FORMAT",
+		usage: "log format: text or json",
+		set: func(cfg *Config, v string) error {
+			v = strings.ToLower(v)
+			switch v {
+			case "text", "json":
+				cfg.Logging.Format = v
+			default:
+				return fmt.Errorf("unknown format %q", v)
+			}
+
+			return nil
+		},
+		get: func(cfg Config) string { return cfg.Logging.Format },
+	},
+	{
+		section: "logging", env: "IPD_LOG_LEVEL",
+		usage: "log level: debug, info, warn or error",
+		set: func(cfg *Config, v string) error {
+			level, err := parseLogLevel(v)
+			cfg.Logging.Level = level
+
+			return err
+		},
+		get: func(cfg Config) string { return strings.ToLower(cfg.Logging.Level.String()) },
+	},
+}
+
+// lookupOption returns the option with the given file key.
+func lookupOption(key string) (option, bool) {
+	for _, opt := range options {
+		if opt.key() == key {
+			return opt, true
+		}
+	}
+
+	return option{}, false
+}
+
+func boolOption(section, env, usage string, field func(*Config) *bool) option {
+	return option{
+		section: section,
+		env:     env,
+		usage:   usage,
+		kind:    boolKind,
+		set: func(cfg *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err //nolint:wrapcheck // Wrapped with the option name by the caller.
+			}
+
+			*field(cfg) = b
+
+			return nil
+		},
+		get: func(cfg Config) string { return strconv.FormatBool(*field(&cfg)) },
+	}
+}
+
+func durationOption(section, env, usage string, field func(*Config) *time.Duration) option {
+	return option{
+		section: section,
+		env:     env,
+		usage:   usage,
+		set: func(cfg *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err //nolint:wrapcheck // Wrapped with the option name by the caller.
+			}
+
+			*field(cfg) = d
+
+			return nil
+		},
+		get: func(cfg Config) string { return field(&cfg).String() },
+	}
+}
+
+func stringOption(section, env, usage string, field func(*Config) *string) option {
+	return option{
+		section: section,
+		env:     env,
+		usage:   usage,
+		kind:    stringKind,
+		set: func(cfg *Config, v string) error {
+			*field(cfg) = v
+
+			return nil
+		},
+		get: func(cfg Config) string { return *field(&cfg) },
+	}
+}
+
+func formatListenAddrs(addrs []ListenAddr) string {
+	items := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		items = append(items, addr.String())
+	}
+
+	return strings.Join(items, ",")
+}
+
+func formatPrefixes(prefixes []netip.Prefix) string {
+	items := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		items = append(items, prefix.String())
+	}
+
+	return strings.Join(items, ",")
+}
+
+func formatProviders(providers []ClientIPProvider) string {
+	items := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		items = append(items, provider.Name+"="+provider.File)
+	}
+
+	return strings.Join(items, ",")
+}
+
+func formatOwner(uid, gid int) string {
+	switch {
+	case uid == -1 && gid == -1:
+		return ""
+	case gid == -1:
+		return strconv.Itoa(uid)
+	default:
+		return strconv.Itoa(uid) + ":" + strconv.Itoa(gid)
+	}
+}
+
+func formatClientAuth(mode tls.ClientAuthType) string {
+	switch mode {
+	case tls.RequestClientCert:
+		return "request"
+	case tls.RequireAnyClientCert:
+		return "require"
+	case tls.VerifyClientCertIfGiven:
+		return "verify_if_given"
+	case tls.RequireAndVerifyClientCert:
+		return "verify"
+	default:
+		return "none"
+	}
+}
+
+func formatUpstreamTLSHeaders(h UpstreamTLSHeaders) string {
+	var pairs []string
+
+	for _, field := range []struct{ name, header string }{
+		{"version", h.Version},
+		{"cipher", h.CipherSuite},
+		{"server_name", h.ServerName},
+		{"alpn", h.ALPN},
+		{"client_cert", h.ClientCert},
+		{"client_verify", h.ClientVerify},
+		{"cloudfront_viewer_tls", h.CloudFrontViewerTLS},
+	} {
+		if field.header != "" {
+			pairs = append(pairs, field.name+"="+field.header)
+		}
+	}
+
+	return strings.Join(pairs, ",")
+}
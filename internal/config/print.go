@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WriteYAML writes every option of the configuration in the configuration file
+// format, so that the output can be loaded again.
+func (c Config) WriteYAML(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+
+	for _, opt := range options {
+		section, ok := sections[opt.section]
+		if !ok {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sections[opt.section] = section
+
+			root.Content = append(root.Content, scalarNode("!!str", opt.section), section)
+		}
+
+		section.Content = append(section.Content, scalarNode("!!str", opt.name()), optionNode(opt, opt.get(c)))
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(root); err != nil {
+		return fmt.Errorf("encode configuration: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("encode configuration: %w", err)
+	}
+
+	return nil
+}
+
+// WriteEnv writes every option of the configuration as IPD_ environment variable
+// assignments.
+func (c Config) WriteEnv(w io.Writer) error {
+	for _, opt := range options {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", opt.env, opt.get(c)); err != nil {
+			return fmt.Errorf("write configuration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func optionNode(opt option, value string) *yaml.Node {
+	switch opt.kind {
+	case boolKind:
+		return scalarNode("!!bool", value)
+	case intKind:
+		return scalarNode("!!int", value)
+	case listKind:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range parseList(value) {
+			list.Content = append(list.Content, scalarNode("!!str", item))
+		}
+
+		return list
+	case mapKind:
+		pairs := &yaml.Node{Kind: yaml.MappingNode}
+
+		for _, item := range parseList(value) {
+			key, val, _ := strings.Cut(item, "=")
+			pairs.Content = append(pairs.Content, scalarNode("!!str", key), scalarNode("!!str", val))
+		}
+
+		if len(pairs.Content) == 0 {
+			pairs.Style = yaml.FlowStyle
+		}
+
+		return pairs
+	default:
+		return scalarNode("!!str", value)
+	}
+}
+
+func scalarNode(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteYAMLRoundTrip(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[server]
+addr = ["127.0.0.1:8080", "unix:///run/ip-detect.sock"]
+unix_socket_mode = "0660"
+unix_socket_owner = "0:0"
+h2c = true
+
+[proxy]
+trust_forwarded = true
+trusted_subnets = ["10.0.0.0/8"]
+upstream_tls_headers = { version = "X-SSL-Protocol", client_verify = "X-SSL-Client-Verify" }
+
+[logging]
+log_level = "warn"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.WriteYAML(&out); err != nil {
+		t.Fatalf("WriteYAML: %v", err)
+	}
+
+	printed := filepath.Join(t.TempDir(), "printed.yaml")
+	if err := os.WriteFile(printed, out.Bytes(), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	reloaded, err := Load(printed)
+	if err != nil {
+		t.Fatalf("Load printed config: %v\n%s", err, out.String())
+	}
+
+	// The printed file sets every option, so it raises no warnings.
+	cfg.Warnings = nil
+
+	if !reflect.DeepEqual(cfg, reloaded) {
+		t.Fatalf("printed configuration differs:\n%+v\n%+v", cfg, reloaded)
+	}
+}
+
+func TestWriteEnv(t *testing.T) {
+	cfg := Default()
+	cfg.Server.H2C = true
+
+	var out bytes.Buffer
+	if err := cfg.WriteEnv(&out); err != nil {
+		t.Fatalf("WriteEnv: %v", err)
+	}
+
+	for _, want := range []string{"IPD_ADDR=:8080\n", "IPD_H2C=true\n", "IPD_TRUSTED_SUBNETS=\n", "IPD_LOG_LEVEL=info\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Package fileerr reports errors found at a line of a file, formatted as
+// "path:line: message" like compiler diagnostics.
+package fileerr
+
+import "fmt"
+
+// LineError is an error at a line of a file. Line is zero when the error applies to
+// the file as a whole.
+type LineError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+// Wrap returns err located at line of the file at path.
+func Wrap(err error, path string, line int) error {
+	return &LineError{Path: path, Line: line, Err: err}
+}
+
+func (e *LineError) Error() string {
+	if e.Line == 0 {
+		return e.Path + ": " + e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
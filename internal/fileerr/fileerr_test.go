@@ -0,0 +1,18 @@
+package fileerr
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	err := Wrap(fs.ErrInvalid, "/etc/ip-detect.yaml", 3)
+	if err.Error() != "/etc/ip-detect.yaml:3: invalid argument" || !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := Wrap(fs.ErrInvalid, "/etc/ip-detect.yaml", 0); err.Error() != "/etc/ip-detect.yaml: invalid argument" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
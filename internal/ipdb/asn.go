@@ -0,0 +1,261 @@
+package ipdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"git.skobk.in/skobkin/ip-detect/internal/fileerr"
+)
+
+var errNoRoutedRanges = errors.New("no routed ranges")
+
+// ASN is the autonomous system announcing an IP address.
+type ASN struct {
+	Number       uint32
+	Organization string
+	// Prefix is the announced network containing the address. TSV datasets list
+	// ranges rather than prefixes; the largest prefix within the range is used.
+	Prefix netip.Prefix
+}
+
+// ASNDB looks up autonomous systems in a GeoLite2-ASN style MaxMind database or in
+// an iptoasn-style TSV file, optionally gzip-compressed.
+type ASNDB struct {
+	*file[asnIndex]
+}
+
+type asnIndex interface {
+	lookup(ip netip.Addr) (ASN, bool)
+}
+
+// OpenASN reads the database at path into memory. Files ending in .mmdb are read as
+// MaxMind databases, anything else as TSV.
+func OpenASN(path string) (*ASNDB, error) {
+	f, err := newFile(path, openASNIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASNDB{file: f}, nil
+}
+
+// Lookup returns the autonomous system announcing ip, or false when it is not routed
+// according to the database.
+func (a *ASNDB) Lookup(ip netip.Addr) (ASN, bool) {
+	return a.current().lookup(ip.Unmap())
+}
+
+func openASNIndex(path string) (asnIndex, error) {
+	if strings.HasSuffix(path, ".mmdb") {
+		reader, err := openMMDB(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return mmdbASN{reader: reader}, nil
+	}
+
+	index, err := readASNTSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+type mmdbASN struct {
+	reader *maxminddb.Reader
+}
+
+func (m mmdbASN) lookup(ip netip.Addr) (ASN, bool) {
+	var record struct {
+		Number       uint32 `maxminddb:"autonomous_system_number"`
+		Organization string `maxminddb:"autonomous_system_organization"`
+	}
+
+	network, ok, err := m.reader.LookupNetwork(ip.AsSlice(), &record)
+	if err != nil || !ok || record.Number == 0 {
+		return ASN{}, false
+	}
+
+	asn := ASN{Number: record.Number, Organization: record.Organization}
+
+	if addr, ok := netip.AddrFromSlice(network.IP); ok {
+		bits, _ := network.Mask.Size()
+		asn.Prefix = netip.PrefixFrom(addr.Unmap(), bits)
+	}
+
+	return asn, true
+}
+
+// asnRange is one line of a TSV dataset: the addresses from start to end, inclusive.
+type asnRange struct {
+	start, end   netip.Addr
+	number       uint32
+	organization string
+}
+
+// rangeIndex holds ranges sorted by their start address, so that lookups are a
+// binary search.
+type rangeIndex []asnRange
+
+func (idx rangeIndex) lookup(ip netip.Addr) (ASN, bool) {
+	// Find the last range starting at or before ip.
+	i, found := slices.BinarySearchFunc(idx, ip, func(r asnRange, ip netip.Addr) int {
+		return r.start.Compare(ip)
+	})
+	if !found {
+		i--
+	}
+
+	if i < 0 || idx[i].end.Less(ip) || idx[i].start.BitLen() != ip.BitLen() {
+		return ASN{}, false
+	}
+
+	r := idx[i]
+
+	return ASN{Number: r.number, Organization: r.organization, Prefix: rangePrefix(r.start, r.end, ip)}, true
+}
+
+// readASNTSV reads lines of "range_start range_end AS_number country AS_description"
+// separated by tabs, as published by iptoasn.com. Ranges of AS 0 are not routed and
+// are left out.
+func readASNTSV(path string) (rangeIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fileerr.Wrap(err, path, 0)
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	return parseASNTSV(r, path)
+}
+
+// parseASNTSV parses a TSV dataset. Errors are located in the file at path.
+func parseASNTSV(r io.Reader, path string) (rangeIndex, error) {
+	var index rangeIndex
+
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		entry, err := parseASNLine(text)
+		if err != nil {
+			return nil, fileerr.Wrap(err, path, line)
+		}
+
+		if entry.number != 0 {
+			index = append(index, entry)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fileerr.Wrap(fmt.Errorf("read: %w", err), path, 0)
+	}
+
+	if len(index) == 0 {
+		return nil, fileerr.Wrap(errNoRoutedRanges, path, 0)
+	}
+
+	slices.SortFunc(index, func(a, b asnRange) int {
+		return a.start.Compare(b.start)
+	})
+
+	return index, nil
+}
+
+func parseASNLine(text string) (asnRange, error) {
+	const fields = 5
+
+	parts := strings.SplitN(text, "\t", fields)
+	if len(parts) < fields-1 {
+		return asnRange{}, fmt.Errorf("expected %d tab-separated fields", fields)
+	}
+
+	start, err := netip.ParseAddr(parts[0])
+	if err != nil {
+		return asnRange{}, fmt.Errorf("parse range start: %w", err)
+	}
+
+	end, err := netip.ParseAddr(parts[1])
+	if err != nil {
+		return asnRange{}, fmt.Errorf("parse range end: %w", err)
+	}
+
+	if start.BitLen() != end.BitLen() || end.Less(start) {
+		return asnRange{}, fmt.Errorf("invalid range %s-%s", start, end)
+	}
+
+	number, err := strconv.ParseUint(strings.TrimPrefix(parts[2], "AS"), 10, 32)
+	if err != nil {
+		return asnRange{}, fmt.Errorf("parse AS number: %w", err)
+	}
+
+	entry := asnRange{start: start.Unmap(), end: end.Unmap(), number: uint32(number)}
+	if len(parts) == fields {
+		entry.organization = strings.TrimSpace(parts[4])
+	}
+
+	return entry, nil
+}
+
+// rangePrefix returns the largest prefix containing ip that lies within the range
+// from start to end.
+func rangePrefix(start, end, ip netip.Addr) netip.Prefix {
+	for bits := 0; bits <= ip.BitLen(); bits++ {
+		prefix := netip.PrefixFrom(ip, bits).Masked()
+		if !prefix.Addr().Less(start) && !end.Less(lastAddr(prefix)) {
+			return prefix
+		}
+	}
+
+	return netip.PrefixFrom(ip, ip.BitLen())
+}
+
+// lastAddr returns the highest address of a masked prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().As16()
+	offset := 0
+
+	if prefix.Addr().Is4() {
+		offset = 96
+	}
+
+	for bit := prefix.Bits() + offset; bit < 128; bit++ {
+		addr[bit/8] |= 1 << (7 - bit%8)
+	}
+
+	if prefix.Addr().Is4() {
+		return netip.AddrFrom16(addr).Unmap()
+	}
+
+	return netip.AddrFrom16(addr)
+}
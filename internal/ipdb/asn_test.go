@@ -0,0 +1,128 @@
+package ipdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb/ipdbtest"
+)
+
+const asnTSV = "# range_start\trange_end\tAS_number\tcountry_code\tAS_description\n" +
+	"192.0.2.0\t192.0.2.255\t64500\tDE\tEXAMPLE-NET Example GmbH\n" +
+	"198.51.100.0\t198.51.100.9\t0\tNone\tNot routed\n" +
+	"198.51.100.10\t198.51.100.200\t64501\tUS\tOTHER-AS\n" +
+	"2001:db8::\t2001:db8:ffff:ffff:ffff:ffff:ffff:ffff\t64502\tNL\tV6-NET\n"
+
+func TestASNDBLookup(t *testing.T) {
+	dir := t.TempDir()
+
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte(asnTSV)); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+
+	files := map[string][]byte{
+		"ip2asn.tsv":    []byte(asnTSV),
+		"ip2asn.tsv.gz": compressed.Bytes(),
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, content, 0o600); err != nil {
+				t.Fatalf("write database: %v", err)
+			}
+
+			db, err := OpenASN(path)
+			if err != nil {
+				t.Fatalf("OpenASN: %v", err)
+			}
+
+			tests := []struct {
+				ip   string
+				want ASN
+				ok   bool
+			}{
+				{"192.0.2.77", ASN{64500, "EXAMPLE-NET Example GmbH", netip.MustParsePrefix("192.0.2.0/24")}, true},
+				{"::ffff:192.0.2.1", ASN{64500, "EXAMPLE-NET Example GmbH", netip.MustParsePrefix("192.0.2.0/24")}, true},
+				{"198.51.100.12", ASN{64501, "OTHER-AS", netip.MustParsePrefix("198.51.100.12/30")}, true},
+				{"198.51.100.5", ASN{}, false},
+				{"198.51.100.201", ASN{}, false},
+				{"2001:db8::1", ASN{64502, "V6-NET", netip.MustParsePrefix("2001:db8::/32")}, true},
+				{"10.0.0.1", ASN{}, false},
+				{"::1", ASN{}, false},
+			}
+
+			for _, tt := range tests {
+				got, ok := db.Lookup(netip.MustParseAddr(tt.ip))
+				if ok != tt.ok || got != tt.want {
+					t.Errorf("Lookup(%s) = %+v, %v, want %+v, %v", tt.ip, got, ok, tt.want, tt.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestASNDBLookupMMDB(t *testing.T) {
+	path := ipdbtest.WriteMMDB(t, "GeoLite2-ASN", map[string]any{
+		"192.0.2.0/24": map[string]any{
+			"autonomous_system_number":       uint32(64500),
+			"autonomous_system_organization": "Example GmbH",
+		},
+		"2001:db8::/32": map[string]any{"autonomous_system_number": uint32(64502)},
+	})
+
+	db, err := OpenASN(path)
+	if err != nil {
+		t.Fatalf("OpenASN: %v", err)
+	}
+
+	got, ok := db.Lookup(netip.MustParseAddr("192.0.2.77"))
+	if want := (ASN{64500, "Example GmbH", netip.MustParsePrefix("192.0.2.0/24")}); !ok || got != want {
+		t.Fatalf("unexpected ASN: %+v", got)
+	}
+
+	got, ok = db.Lookup(netip.MustParseAddr("2001:db8::1"))
+	if want := (ASN{Number: 64502, Prefix: netip.MustParsePrefix("2001:db8::/32")}); !ok || got != want {
+		t.Fatalf("unexpected ASN: %+v", got)
+	}
+
+	if _, ok := db.Lookup(netip.MustParseAddr("198.51.100.1")); ok {
+		t.Fatal("expected no record outside the database")
+	}
+}
+
+func TestASNDBInvalidTSV(t *testing.T) {
+	tests := map[string]string{
+		"bad address": "192.0.2.0\tbogus\t64500\tDE\tX\n",
+		"bad number":  "192.0.2.0\t192.0.2.255\tASX\tDE\tX\n",
+		"reversed":    "192.0.2.255\t192.0.2.0\t64500\tDE\tX\n",
+		"mixed":       "192.0.2.0\t2001:db8::\t64500\tDE\tX\n",
+		"too short":   "192.0.2.0\t192.0.2.255\n",
+		"not routed":  "192.0.2.0\t192.0.2.255\t0\tNone\tNot routed\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatalf("write database: %v", err)
+			}
+
+			if _, err := OpenASN(path); err == nil || !strings.HasPrefix(err.Error(), path+":") {
+				t.Fatalf("expected an error naming the file, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package ipdb
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// nameLanguage is the language place names are reported in.
+const nameLanguage = "en"
+
+// Location is where an IP address is according to a GeoIP database. Fields missing
+// from the database are left empty.
+type Location struct {
+	CountryCode string
+	Country     string
+	RegionCode  string
+	Region      string
+	City        string
+	PostalCode  string
+	// Latitude, Longitude and AccuracyRadius, in kilometers, are only meaningful
+	// when HasCoordinates is set.
+	Latitude       float64
+	Longitude      float64
+	AccuracyRadius uint16
+	HasCoordinates bool
+	TimeZone       string
+}
+
+// GeoDB looks up locations in a MaxMind-format City or Country database, such as
+// GeoLite2-City or DB-IP City Lite.
+type GeoDB struct {
+	*file[*maxminddb.Reader]
+}
+
+// OpenGeo reads the database at path into memory.
+func OpenGeo(path string) (*GeoDB, error) {
+	f, err := newFile(path, openMMDB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeoDB{file: f}, nil
+}
+
+// cityRecord is the part of a City or Country database record that is reported.
+// Country databases only fill the country fields.
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country           countryRecord `maxminddb:"country"`
+	RegisteredCountry countryRecord `maxminddb:"registered_country"`
+	Subdivisions      []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Location struct {
+		Latitude       *float64 `maxminddb:"latitude"`
+		Longitude      *float64 `maxminddb:"longitude"`
+		AccuracyRadius uint16   `maxminddb:"accuracy_radius"`
+		TimeZone       string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+}
+
+type countryRecord struct {
+	ISOCode string            `maxminddb:"iso_code"`
+	Names   map[string]string `maxminddb:"names"`
+}
+
+// Lookup returns the location of ip, or false when the database has no record for it.
+func (g *GeoDB) Lookup(ip netip.Addr) (Location, bool) {
+	var record cityRecord
+
+	_, ok, err := g.current().LookupNetwork(ip.Unmap().AsSlice(), &record)
+	if err != nil || !ok {
+		return Location{}, false
+	}
+
+	// Addresses without a known location, such as anycast ranges, may only have
+	// the country the network is registered in.
+	country := record.Country
+	if country.ISOCode == "" {
+		country = record.RegisteredCountry
+	}
+
+	location := Location{
+		CountryCode:    country.ISOCode,
+		Country:        country.Names[nameLanguage],
+		City:           record.City.Names[nameLanguage],
+		PostalCode:     record.Postal.Code,
+		AccuracyRadius: record.Location.AccuracyRadius,
+		TimeZone:       record.Location.TimeZone,
+	}
+
+	// The first subdivision is the largest, e.g. the state rather than the county.
+	if len(record.Subdivisions) > 0 {
+		location.RegionCode = record.Subdivisions[0].ISOCode
+		location.Region = record.Subdivisions[0].Names[nameLanguage]
+	}
+
+	if record.Location.Latitude != nil && record.Location.Longitude != nil {
+		location.Latitude = *record.Location.Latitude
+		location.Longitude = *record.Location.Longitude
+		location.HasCoordinates = true
+	}
+
+	return location, true
+}
+
+// openMMDB reads a MaxMind DB file into memory and verifies it, so that a file
+// replaced by a partial or broken copy is rejected rather than served.
+func openMMDB(path string) (*maxminddb.Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read database: %w", err)
+	}
+
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+
+	if err := reader.Verify(); err != nil {
+		return nil, fmt.Errorf("verify %s: %w", path, err)
+	}
+
+	return reader, nil
+}
@@ -0,0 +1,107 @@
+package ipdb
+
+import (
+	"net/netip"
+	"os"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb/ipdbtest"
+)
+
+func cityRecordFixture(city string) map[string]any {
+	return map[string]any{
+		"city":    map[string]any{"names": map[string]any{"en": city}},
+		"country": map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany", "de": "Deutschland"}},
+		"subdivisions": []any{
+			map[string]any{"iso_code": "BE", "names": map[string]any{"en": "Land Berlin"}},
+		},
+		"postal": map[string]any{"code": "10115"},
+		"location": map[string]any{
+			"latitude":        52.52,
+			"longitude":       13.405,
+			"accuracy_radius": uint16(20),
+			"time_zone":       "Europe/Berlin",
+		},
+	}
+}
+
+func TestGeoDBLookup(t *testing.T) {
+	path := ipdbtest.WriteMMDB(t, "GeoLite2-City", map[string]any{
+		"192.0.2.0/24": cityRecordFixture("Berlin"),
+		"2001:db8::/32": map[string]any{
+			"registered_country": map[string]any{"iso_code": "NL", "names": map[string]any{"en": "Netherlands"}},
+		},
+	})
+
+	db, err := OpenGeo(path)
+	if err != nil {
+		t.Fatalf("OpenGeo: %v", err)
+	}
+
+	location, ok := db.Lookup(netip.MustParseAddr("192.0.2.77"))
+	want := Location{
+		CountryCode: "DE", Country: "Germany", RegionCode: "BE", Region: "Land Berlin", City: "Berlin",
+		PostalCode: "10115", Latitude: 52.52, Longitude: 13.405, AccuracyRadius: 20, HasCoordinates: true,
+		TimeZone: "Europe/Berlin",
+	}
+
+	if !ok || location != want {
+		t.Fatalf("unexpected location: %+v", location)
+	}
+
+	if location, ok := db.Lookup(netip.MustParseAddr("::ffff:192.0.2.1")); !ok || location.City != "Berlin" {
+		t.Fatalf("expected IPv4-mapped addresses to be found, got %+v", location)
+	}
+
+	location, ok = db.Lookup(netip.MustParseAddr("2001:db8::1"))
+	if !ok || location.CountryCode != "NL" || location.HasCoordinates {
+		t.Fatalf("expected the registered country only, got %+v", location)
+	}
+
+	if _, ok := db.Lookup(netip.MustParseAddr("198.51.100.1")); ok {
+		t.Fatal("expected no record outside the database")
+	}
+}
+
+func TestGeoDBReload(t *testing.T) {
+	path := ipdbtest.WriteMMDB(t, "GeoLite2-City", map[string]any{"192.0.2.0/24": cityRecordFixture("Berlin")})
+
+	db, err := OpenGeo(path)
+	if err != nil {
+		t.Fatalf("OpenGeo: %v", err)
+	}
+
+	if reloaded, err := db.ReloadIfChanged(); reloaded || err != nil {
+		t.Fatalf("expected no reload for an unchanged file, got %v, %v", reloaded, err)
+	}
+
+	replacement, err := os.ReadFile(ipdbtest.WriteMMDB(t, "GeoLite2-City", map[string]any{"192.0.2.0/24": cityRecordFixture("Hamburg")}))
+	if err != nil {
+		t.Fatalf("read replacement: %v", err)
+	}
+
+	// A truncated copy is rejected and the loaded data stays in use.
+	if err := os.WriteFile(path, replacement[:len(replacement)/2], 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, err := db.ReloadIfChanged(); err == nil {
+		t.Fatal("expected a truncated database to be rejected")
+	}
+
+	if location, _ := db.Lookup(netip.MustParseAddr("192.0.2.1")); location.City != "Berlin" {
+		t.Fatalf("expected the previous database to stay in use, got %+v", location)
+	}
+
+	if err := os.WriteFile(path, replacement, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if reloaded, err := db.ReloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("expected a reload, got %v, %v", reloaded, err)
+	}
+
+	if location, _ := db.Lookup(netip.MustParseAddr("192.0.2.1")); location.City != "Hamburg" {
+		t.Fatalf("expected the replaced database, got %+v", location)
+	}
+}
@@ -0,0 +1,98 @@
+// Package ipdb looks up details about IP addresses in local database files and
+// reloads them when the files are replaced.
+package ipdb
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Database is a database file that can be reloaded while lookups are running.
+type Database interface {
+	// Path returns the file the database is read from.
+	Path() string
+	// ReloadIfChanged reads the file again if it was replaced since it was last
+	// read and reports whether it did. The current data is kept on failure.
+	ReloadIfChanged() (bool, error)
+}
+
+// file holds the data read from a database file and swaps it when the file
+// changes, so that lookups never wait for a reload.
+type file[T any] struct {
+	path string
+	open func(path string) (T, error)
+	data atomic.Pointer[T]
+
+	mu    sync.Mutex
+	stamp fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newFile[T any](path string, open func(path string) (T, error)) (*file[T], error) {
+	f := &file[T]{path: path, open: open}
+
+	stamp, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.load(stamp); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Path returns the file the database is read from.
+func (f *file[T]) Path() string {
+	return f.path
+}
+
+// ReloadIfChanged reads the file again if it was replaced since it was last read.
+func (f *file[T]) ReloadIfChanged() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stamp, err := statFile(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	if stamp == f.stamp {
+		return false, nil
+	}
+
+	return true, f.load(stamp)
+}
+
+func (f *file[T]) current() T {
+	return *f.data.Load()
+}
+
+func (f *file[T]) load(stamp fileStamp) error {
+	data, err := f.open(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.data.Store(&data)
+	f.stamp = stamp
+
+	return nil
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,177 @@
+// Package ipdbtest writes small database files for tests of code using ipdb.
+package ipdbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// WriteMMDB writes a MaxMind DB (IPv6 tree, 24-bit records) mapping each prefix to
+// its record and returns its path. Records are built from strings, float64, uint16, uint32, slices and
+// maps, which is all the databases used here need. Prefixes must not overlap.
+func WriteMMDB(t *testing.T, databaseType string, records map[string]any) string {
+	t.Helper()
+
+	type node struct{ children [2]any } // *node, data offset (int) or nil
+
+	root := &node{}
+
+	var data bytes.Buffer
+
+	for _, key := range slices.Sorted(maps.Keys(records)) {
+		prefix := netip.MustParsePrefix(key)
+		bits, addr := prefix.Bits(), prefix.Addr().As16()
+
+		// IPv4 addresses live in ::/96, where the reader looks them up.
+		if prefix.Addr().Is4() {
+			v4 := prefix.Addr().As4()
+			addr = [16]byte{}
+			copy(addr[12:], v4[:])
+			bits += 96
+		}
+
+		offset := data.Len()
+		encodeMMDB(&data, records[key])
+
+		current := root
+		for i := range bits {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				current.children[bit] = offset
+
+				break
+			}
+
+			next, ok := current.children[bit].(*node)
+			if !ok {
+				next = &node{}
+				current.children[bit] = next
+			}
+
+			current = next
+		}
+	}
+
+	var nodes []*node
+
+	index := map[*node]int{}
+	queue := []*node{root}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+
+		for _, child := range n.children {
+			if c, ok := child.(*node); ok {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+
+	for _, n := range nodes {
+		for _, child := range n.children {
+			record := len(nodes)
+
+			switch c := child.(type) {
+			case *node:
+				record = index[c]
+			case int:
+				record = len(nodes) + 16 + c
+			}
+
+			out.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDB(&out, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint32(1700000000),
+		"database_type":               databaseType,
+		"description":                 map[string]any{"en": "test database"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})
+
+	path := filepath.Join(t.TempDir(), databaseType+".mmdb")
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+
+	return path
+}
+
+func encodeMMDB(buf *bytes.Buffer, value any) {
+	control := func(typ, size int) {
+		var ext []byte
+		if typ > 7 {
+			ext = []byte{byte(typ - 7)}
+			typ = 0
+		}
+
+		switch {
+		case size < 29:
+			buf.WriteByte(byte(typ<<5 | size))
+			buf.Write(ext)
+		case size < 285:
+			buf.WriteByte(byte(typ<<5 | 29))
+			buf.Write(ext)
+			buf.WriteByte(byte(size - 29))
+		default:
+			buf.WriteByte(byte(typ<<5 | 30))
+			buf.Write(ext)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(size-285)))
+		}
+	}
+
+	unsigned := func(typ int, v uint64, width int) {
+		b := binary.BigEndian.AppendUint64(nil, v)[8-width:]
+		b = bytes.TrimLeft(b, "\x00")
+		control(typ, len(b))
+		buf.Write(b)
+	}
+
+	switch v := value.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(3, 8)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case uint16:
+		unsigned(5, uint64(v), 2)
+	case uint32:
+		unsigned(6, uint64(v), 4)
+	case []any:
+		control(11, len(v))
+
+		for _, item := range v {
+			encodeMMDB(buf, item)
+		}
+	case map[string]any:
+		control(7, len(v))
+
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			encodeMMDB(buf, key)
+			encodeMMDB(buf, v[key])
+		}
+	default:
+		panic("unsupported value type")
+	}
+}
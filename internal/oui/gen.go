@@ -0,0 +1,169 @@
+//go:build ignore
+
+// Gen downloads the IEEE MA-L registry and writes it to oui.tsv in the format read
+// by the oui package, recording the source and the retrieval date. It is run by
+// go generate.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSource = "https://standards-oui.ieee.org/oui/oui.csv"
+	fetchTimeout  = 2 * time.Minute
+)
+
+type assignment struct {
+	prefix string
+	name   string
+}
+
+func main() {
+	source := flag.String("source", defaultSource, "URL of the registry in CSV format")
+	output := flag.String("o", "oui.tsv", "output file")
+	flag.Parse()
+
+	if err := run(*source, *output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(source, output string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	// The IEEE server rejects requests without a user agent of its liking.
+	req.Header.Set("User-Agent", "ip-detect-oui-generator/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("download registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download registry: %s", resp.Status)
+	}
+
+	assignments, err := parseRegistry(resp.Body)
+	if err != nil {
+		return fmt.Errorf("parse registry: %w", err)
+	}
+
+	return writeTable(output, source, time.Now().UTC(), assignments)
+}
+
+// parseRegistry reads the "Registry,Assignment,Organization Name,Organization
+// Address" records of the MA-L CSV and returns them sorted by prefix.
+func parseRegistry(r io.Reader) ([]assignment, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	if len(header) < 3 || header[1] != "Assignment" || header[2] != "Organization Name" {
+		return nil, fmt.Errorf("unexpected header %q", header)
+	}
+
+	var assignments []assignment
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("read record: %w", err)
+		}
+
+		if len(record) < 3 || record[0] != "MA-L" || len(record[1]) != 6 {
+			continue
+		}
+
+		// Names occasionally contain line breaks or runs of spaces.
+		name := strings.Join(strings.Fields(record[2]), " ")
+		if name == "" {
+			continue
+		}
+
+		assignments = append(assignments, assignment{prefix: strings.ToUpper(record[1]), name: name})
+	}
+
+	if len(assignments) == 0 {
+		return nil, errors.New("no MA-L assignments")
+	}
+
+	slices.SortFunc(assignments, func(a, b assignment) int {
+		return cmp.Compare(a.prefix, b.prefix)
+	})
+
+	return slices.CompactFunc(assignments, func(a, b assignment) bool {
+		return a.prefix == b.prefix
+	}), nil
+}
+
+// writeTable replaces output atomically, so that a failed run leaves the previous
+// table in place.
+func writeTable(output, source string, retrieved time.Time, assignments []assignment) error {
+	var b strings.Builder
+
+	b.WriteString("# IEEE MA-L registry: the first three octets of a MAC address in hex, a tab, and the\n")
+	b.WriteString("# organization name. Generated by gen.go; do not edit.\n")
+	fmt.Fprintf(&b, "# Source: %s\n", source)
+	fmt.Fprintf(&b, "# Retrieved: %s\n", retrieved.Format(time.DateOnly))
+
+	for _, a := range assignments {
+		b.WriteString(a.prefix + "\t" + a.name + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".oui-*.tsv")
+	if err != nil {
+		return fmt.Errorf("create output: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		return fmt.Errorf("replace output: %w", err)
+	}
+
+	return nil
+}
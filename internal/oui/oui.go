@@ -0,0 +1,57 @@
+// Package oui names the organizations that MAC address prefixes are assigned to.
+package oui
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:generate go run gen.go
+
+// table lists OUIs from the IEEE MA-L registry: a curated subset until gen.go is
+// run to download the full registry.
+//
+//go:embed oui.tsv
+var table string
+
+var vendors = sync.OnceValue(func() map[uint32]string {
+	return parse(table)
+})
+
+// Vendor returns the organization the OUI of mac is assigned to. Locally
+// administered and multicast addresses have no vendor.
+func Vendor(mac [6]byte) (string, bool) {
+	const localOrGroup = 0x03
+
+	if mac[0]&localOrGroup != 0 {
+		return "", false
+	}
+
+	vendor, ok := vendors()[uint32(mac[0])<<16|uint32(mac[1])<<8|uint32(mac[2])]
+
+	return vendor, ok
+}
+
+// parse reads lines of six hex digits and an organization name separated by a tab.
+// Comments and malformed lines are skipped.
+func parse(data string) map[uint32]string {
+	result := make(map[uint32]string)
+
+	for line := range strings.Lines(data) {
+		prefix, name, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || len(prefix) != 6 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(prefix, 16, 32)
+		if err != nil {
+			continue
+		}
+
+		result[uint32(value)] = strings.TrimSpace(name)
+	}
+
+	return result
+}
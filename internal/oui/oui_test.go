@@ -0,0 +1,31 @@
+package oui
+
+import "testing"
+
+func TestVendor(t *testing.T) {
+	tests := []struct {
+		mac    [6]byte
+		vendor string
+		ok     bool
+	}{
+		{[6]byte{0x00, 0x50, 0x56, 0x01, 0x02, 0x03}, "VMware, Inc.", true},
+		{[6]byte{0xb8, 0x27, 0xeb, 0xaa, 0xbb, 0xcc}, "Raspberry Pi Foundation", true},
+		{[6]byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}, "", false},
+		{[6]byte{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01}, "", false},
+		{[6]byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x01}, "", false},
+	}
+
+	for _, tt := range tests {
+		vendor, ok := Vendor(tt.mac)
+		if vendor != tt.vendor || ok != tt.ok {
+			t.Errorf("Vendor(% x) = %q, %v, want %q, %v", tt.mac, vendor, ok, tt.vendor, tt.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	got := parse("# comment\n00000C\tCisco Systems, Inc\nbogus line\nZZZZZZ\tBad\n0050F2\t Microsoft Corporation \n")
+	if len(got) != 2 || got[0x00000c] != "Cisco Systems, Inc" || got[0x0050f2] != "Microsoft Corporation" {
+		t.Fatalf("unexpected table: %v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+// newACMEManager builds an autocert manager for the configured domains and directory.
+func newACMEManager(cfg config.ServerConfig) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: cfg.ACMEDirectoryURL}
+
+	if cfg.ACMECAFile != "" {
+		httpClient, err := newACMEHTTPClient(cfg.ACMECAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		client.HTTPClient = httpClient
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+		Client:     client,
+		Email:      cfg.ACMEEmail,
+	}
+
+	if cfg.ACMECacheDir != "" {
+		manager.Cache = autocert.DirCache(cfg.ACMECacheDir)
+	}
+
+	return manager, nil
+}
+
+// newACMEHTTPClient trusts an extra CA bundle when talking to the ACME directory,
+// which is needed for private or test CAs such as Pebble.
+func newACMEHTTPClient(caFile string) (*http.Client, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if err := appendCertsFromFile(pool, caFile); err != nil {
+		return nil, fmt.Errorf("load ACME CA file: %w", err)
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		transport = &http.Transport{}
+	}
+
+	transport = transport.Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+
+	return &http.Client{Transport: transport}, nil
+}
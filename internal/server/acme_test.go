@@ -0,0 +1,70 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestNewWithACME(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeTestCertificate(t, dir, "pebble.example")
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Server.TLSAddrs = []config.ListenAddr{{Network: "tcp", Address: ":8443"}}
+	cfg.Server.ACMEDomains = []string{"ip.example.com"}
+	cfg.Server.ACMEDirectoryURL = "https://localhost:14000/dir"
+	cfg.Server.ACMECacheDir = filepath.Join(dir, "cache")
+	cfg.Server.ACMECAFile = caFile
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if !slices.Contains(app.httpServer.TLSConfig.NextProtos, acme.ALPNProto) {
+		t.Fatalf("TLS-ALPN-01 protocol not offered: %v", app.httpServer.TLSConfig.NextProtos)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://evil.example.com/.well-known/acme-challenge/token", nil)
+	res := httptest.NewRecorder()
+	app.httpServer.Handler.ServeHTTP(res, req)
+
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected challenge for unknown host to be refused, got %d", res.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/plain", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	res = httptest.NewRecorder()
+	app.httpServer.Handler.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected regular requests to reach the handler, got %d", res.Code)
+	}
+}
+
+func TestNewWithACMERejectsBadCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Server.ACMEDomains = []string{"ip.example.com"}
+	cfg.Server.ACMECAFile = caFile
+
+	if _, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Fatalf("expected error for CA file without certificates")
+	}
+}
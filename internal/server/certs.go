@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// certReloader serves a certificate pair from disk and swaps it in place when the files change,
+// so established connections keep working and new handshakes pick up the fresh pair.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu      sync.Mutex
+	certMod fileStamp
+	keyMod  fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Reload unconditionally re-reads the certificate pair. The current pair is kept on failure.
+func (c *certReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.load()
+}
+
+func (c *certReloader) reloadIfChanged() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	certMod, err := statFile(c.certFile)
+	if err != nil {
+		return false, err
+	}
+
+	keyMod, err := statFile(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	if certMod == c.certMod && keyMod == c.keyMod {
+		return false, nil
+	}
+
+	return true, c.load()
+}
+
+func (c *certReloader) load() error {
+	certMod, err := statFile(c.certFile)
+	if err != nil {
+		return err
+	}
+
+	keyMod, err := statFile(c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate pair: %w", err)
+	}
+
+	c.cert.Store(&cert)
+	c.certMod = certMod
+	c.keyMod = keyMod
+
+	return nil
+}
+
+// watch polls the certificate files until the context is canceled.
+func (c *certReloader) watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reloadIfChanged()
+			if err != nil {
+				c.logger.Error("certificate reload failed", "cert", c.certFile, "key", c.keyFile, "error", err)
+
+				continue
+			}
+
+			if reloaded {
+				c.logger.Info("certificate reloaded", "cert", c.certFile, "key", c.keyFile)
+			}
+		}
+	}
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, "first.example")
+
+	reloader, err := newCertReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+
+	if got := servedCommonName(t, reloader); got != "first.example" {
+		t.Fatalf("unexpected initial certificate: %s", got)
+	}
+
+	reloaded, err := reloader.reloadIfChanged()
+	if err != nil || reloaded {
+		t.Fatalf("expected no reload for unchanged files, got reloaded=%v err=%v", reloaded, err)
+	}
+
+	writeTestCertificate(t, dir, "second.example")
+
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	reloaded, err = reloader.reloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("expected reload for changed files, got reloaded=%v err=%v", reloaded, err)
+	}
+
+	if got := servedCommonName(t, reloader); got != "second.example" {
+		t.Fatalf("unexpected reloaded certificate: %s", got)
+	}
+
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+
+	if err := reloader.Reload(); err == nil {
+		t.Fatalf("expected reload error for broken certificate")
+	}
+
+	if got := servedCommonName(t, reloader); got != "second.example" {
+		t.Fatalf("broken reload replaced certificate: %s", got)
+	}
+}
+
+func servedCommonName(t *testing.T, reloader *certReloader) string {
+	t.Helper()
+
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+// writeTestCertificate writes a self-signed certificate pair for commonName into dir.
+func writeTestCertificate(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	return certFile, keyFile
+}
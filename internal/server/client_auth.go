@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"golang.org/x/crypto/acme"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+var errNoCertificates = errors.New("no certificates found")
+
+// configureClientAuth asks clients for certificates according to the configured mode.
+// In the request/require modes crypto/tls does not verify the chain, so it is checked
+// against the CA bundle here purely for reporting and never fails the handshake.
+func configureClientAuth(tlsCfg *tls.Config, cfg config.ServerConfig) error {
+	if cfg.TLSClientAuth == tls.NoClientCert {
+		return nil
+	}
+
+	var pool *x509.CertPool
+
+	if cfg.TLSClientCAFile != "" {
+		pool = x509.NewCertPool()
+		if err := appendCertsFromFile(pool, cfg.TLSClientCAFile); err != nil {
+			return fmt.Errorf("load client CA: %w", err)
+		}
+	}
+
+	tlsCfg.ClientAuth = cfg.TLSClientAuth
+	tlsCfg.ClientCAs = pool
+
+	recordHello := tlsCfg.GetConfigForClient
+	verifyManually := pool != nil && cfg.TLSClientAuth < tls.VerifyClientCertIfGiven
+
+	tlsCfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if _, err := recordHello(hello); err != nil {
+			return nil, err
+		}
+
+		connCfg := tlsCfg.Clone()
+
+		// ACME TLS-ALPN-01 validation connections never carry a client certificate.
+		if slices.Equal(hello.SupportedProtos, []string{acme.ALPNProto}) {
+			connCfg.ClientAuth = tls.NoClientCert
+
+			return connCfg, nil
+		}
+
+		if verifyManually {
+			ctx := hello.Context()
+			connCfg.VerifyConnection = func(state tls.ConnectionState) error {
+				if len(state.PeerCertificates) > 0 {
+					clientinfo.RecordClientCertVerification(ctx, verifyClientChain(state.PeerCertificates, pool))
+				}
+
+				return nil
+			}
+		}
+
+		return connCfg, nil
+	}
+
+	return nil
+}
+
+func verifyClientChain(chain []*x509.Certificate, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("verify client certificate: %w", err)
+	}
+
+	return nil
+}
+
+func appendCertsFromFile(pool *x509.CertPool, path string) error {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("%w in %s", errNoCertificates, path)
+	}
+
+	return nil
+}
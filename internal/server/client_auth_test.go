@@ -0,0 +1,76 @@
+package server
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestClientCertificateInspection(t *testing.T) {
+	clientCert, clientKey := writeTestCertificate(t, t.TempDir(), "client.example")
+	otherCA, _ := writeTestCertificate(t, t.TempDir(), "other-ca.example")
+
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("load client pair: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		mode      tls.ClientAuthType
+		caFile    string
+		verified  *bool
+		withError bool
+	}{
+		{name: "request without CA", mode: tls.RequestClientCert},
+		{name: "request with matching CA", mode: tls.RequestClientCert, caFile: clientCert, verified: boolValue(true)},
+		{name: "require with foreign CA", mode: tls.RequireAnyClientCert, caFile: otherCA, verified: boolValue(false), withError: true},
+		{name: "verify", mode: tls.RequireAndVerifyClientCert, caFile: clientCert, verified: boolValue(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Resolver.EnableReverseDNS = false
+			cfg.Server.TLSClientAuth = tt.mode
+			cfg.Server.TLSClientCAFile = tt.caFile
+
+			payload := fetchJSONOverTLS(t, cfg, &tls.Config{ //nolint:gosec // Self-signed test certificate.
+				InsecureSkipVerify: true,
+				// Always present the certificate, even when the server advertises other CAs.
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &pair, nil
+				},
+			})
+
+			info := payload.ClientCertificate
+			if info == nil || len(info.Chain) != 1 {
+				t.Fatalf("missing client certificate: %+v", info)
+			}
+
+			if info.Chain[0].Subject != "CN=client.example" || info.Chain[0].KeyType != "ECDSA P-256" {
+				t.Fatalf("unexpected certificate details: %+v", info.Chain[0])
+			}
+
+			if len(info.Chain[0].SANs) != 1 || info.Chain[0].SANs[0] != "DNS:client.example" {
+				t.Fatalf("unexpected SANs: %v", info.Chain[0].SANs)
+			}
+
+			switch {
+			case tt.verified == nil && info.Verified != nil:
+				t.Fatalf("expected no verification, got %v", *info.Verified)
+			case tt.verified != nil && (info.Verified == nil || *info.Verified != *tt.verified):
+				t.Fatalf("expected verified=%v, got %v", *tt.verified, info.Verified)
+			}
+
+			if tt.withError != (info.VerificationError != nil) {
+				t.Fatalf("unexpected verification error: %v", info.VerificationError)
+			}
+		})
+	}
+}
+
+func boolValue(value bool) *bool {
+	return &value
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb"
+)
+
+// openDatabases opens the enrichment databases named in the configuration. Changing
+// the paths takes a restart; replacing the files does not.
+func (a *App) openDatabases(cfg config.EnrichmentConfig) error {
+	if cfg.GeoIPDatabase != "" {
+		db, err := ipdb.OpenGeo(cfg.GeoIPDatabase)
+		if err != nil {
+			return err //nolint:wrapcheck // Errors from ipdb already name the file.
+		}
+
+		a.geoIP = db
+		a.databases = append(a.databases, db)
+	}
+
+	if cfg.ASNDatabase != "" {
+		db, err := ipdb.OpenASN(cfg.ASNDatabase)
+		if err != nil {
+			return err //nolint:wrapcheck // Errors from ipdb already name the file.
+		}
+
+		a.asn = db
+		a.databases = append(a.databases, db)
+	}
+
+	return nil
+}
+
+// reloadDatabases reads every database whose file was replaced. A database that
+// fails to load keeps its current data.
+func (a *App) reloadDatabases() {
+	for _, db := range a.databases {
+		reloaded, err := db.ReloadIfChanged()
+		if err != nil {
+			a.logger.Error("database reload failed, keeping the current data", "path", db.Path(), "error", err)
+
+			continue
+		}
+
+		if reloaded {
+			a.logger.Info("database reloaded", "path", db.Path())
+		}
+	}
+}
+
+// watchDatabases polls the database files until the context is canceled.
+func (a *App) watchDatabases(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.reloadDatabases()
+		}
+	}
+}
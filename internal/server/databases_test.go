@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb/ipdbtest"
+)
+
+func TestGeoIPDatabase(t *testing.T) {
+	city := func(name string) map[string]any {
+		return map[string]any{
+			"city":     map[string]any{"names": map[string]any{"en": name}},
+			"country":  map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany"}},
+			"location": map[string]any{"latitude": 52.52, "longitude": 13.405, "time_zone": "Europe/Berlin"},
+		}
+	}
+
+	path := ipdbtest.WriteMMDB(t, "GeoLite2-City", map[string]any{"198.51.100.0/24": city("Berlin")})
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Enrichment.GeoIPDatabase = path
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	lookup := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "198.51.100.10:1234"
+
+		res := httptest.NewRecorder()
+		app.httpServer.Handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	geo := func() *clientinfo.GeoInfo {
+		var payload clientinfo.Data
+		if err := json.Unmarshal(lookup("/json").Body.Bytes(), &payload); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+
+		if payload.Geo == nil || payload.Geo.City == nil {
+			t.Fatalf("missing geo data: %+v", payload.Geo)
+		}
+
+		return payload.Geo
+	}
+
+	if got := geo(); *got.City != "Berlin" || *got.CountryCode != "DE" || *got.TimeZone != "Europe/Berlin" {
+		t.Fatalf("unexpected geo data: %+v", got)
+	}
+
+	if body := lookup("/").Body.String(); !strings.Contains(body, "<h2>Location</h2>") || !strings.Contains(body, "Germany (DE)") {
+		t.Fatal("expected the location section in HTML")
+	}
+
+	replacement, err := os.ReadFile(ipdbtest.WriteMMDB(t, "GeoLite2-City", map[string]any{"198.51.100.0/24": city("Potsdam")}))
+	if err != nil {
+		t.Fatalf("read replacement: %v", err)
+	}
+
+	if err := os.WriteFile(path, replacement, 0o600); err != nil {
+		t.Fatalf("replace database: %v", err)
+	}
+
+	app.reloadDatabases()
+
+	if got := geo(); *got.City != "Potsdam" {
+		t.Fatalf("expected the replaced database to be used, got %s", *got.City)
+	}
+}
+
+func TestGeoIPDatabaseMissing(t *testing.T) {
+	cfg := config.Default()
+	cfg.Enrichment.GeoIPDatabase = "/nonexistent/GeoLite2-City.mmdb"
+
+	if _, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil || !strings.Contains(err.Error(), cfg.Enrichment.GeoIPDatabase) {
+		t.Fatalf("expected an error naming the database, got %v", err)
+	}
+}
+
+func TestASNDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if err := os.WriteFile(path, []byte("198.51.100.0\t198.51.100.255\t64500\tDE\tEXAMPLE-NET\n"), 0o600); err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Enrichment.ASNDatabase = path
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	lookup := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "198.51.100.10:1234"
+
+		res := httptest.NewRecorder()
+		app.httpServer.Handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	var payload clientinfo.Data
+	if err := json.Unmarshal(lookup("/json").Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+
+	if got := payload.ASN; got == nil || got.Number != 64500 || *got.Organization != "EXAMPLE-NET" || *got.Prefix != "198.51.100.0/24" {
+		t.Fatalf("unexpected ASN data: %+v", got)
+	}
+
+	if body := lookup("/").Body.String(); !strings.Contains(body, "<h2>Network</h2>") || !strings.Contains(body, "AS64500") {
+		t.Fatal("expected the network section in HTML")
+	}
+}
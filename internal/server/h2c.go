@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+// enableH2C accepts cleartext HTTP/2 on the plain listeners. net/http handles
+// connections that start with the HTTP/2 preface (prior knowledge) itself, while the
+// "Upgrade: h2c" handshake still needs x/net's h2c handler.
+func enableH2C(srv *http.Server, cfg config.ServerConfig) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv.Protocols = protocols
+
+	next := srv.Handler
+	//nolint:staticcheck // net/http does not implement the h2c Upgrade handshake.
+	upgrade := h2c.NewHandler(next, &http2.Server{IdleTimeout: cfg.IdleTimeout})
+
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The h2c upgrade token only applies to cleartext connections (RFC 7540, section 3.2).
+		if r.TLS != nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		upgrade.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	addr := serveH2C(t)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+
+	payload := fetchJSON(t, &http.Client{Transport: &http.Transport{Protocols: protocols}}, "http://"+addr+"/json")
+
+	if payload.Connection == nil || payload.Connection.Protocol == nil || *payload.Connection.Protocol != "HTTP/2.0" {
+		t.Fatalf("unexpected connection info: %+v", payload.Connection)
+	}
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	addr := serveH2C(t)
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "GET /json HTTP/1.1\r\nHost: "+addr+"\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\n\r\n")
+	if err != nil {
+		t.Fatalf("write upgrade request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("read upgrade response: %v", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %s", res.Status)
+	}
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatalf("write preface: %v", err)
+	}
+
+	framer := http2.NewFramer(conn, reader)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+
+	// The upgraded request is answered on stream 1.
+	var body bytes.Buffer
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+
+		data, ok := frame.(*http2.DataFrame)
+		if !ok || data.StreamID != 1 {
+			continue
+		}
+
+		body.Write(data.Data())
+
+		if data.StreamEnded() {
+			break
+		}
+	}
+
+	var payload clientinfo.Data
+	if err := json.Unmarshal(body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+
+	if payload.Connection == nil || payload.Connection.Protocol == nil || *payload.Connection.Protocol != "HTTP/2.0" {
+		t.Fatalf("unexpected connection info: %+v", payload.Connection)
+	}
+}
+
+func serveH2C(t *testing.T) string {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Server.H2C = true
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	go func() {
+		_ = app.httpServer.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		_ = app.httpServer.Close()
+	})
+
+	return ln.Addr().String()
+}
@@ -7,6 +7,7 @@ import (
 	"html/template"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
@@ -15,9 +16,11 @@ import (
 )
 
 type handler struct {
-	cfg    config.Config
-	logger *slog.Logger
-	tpl    *template.Template
+	// cfg and sources are swapped when the configuration is reloaded.
+	cfg     atomic.Pointer[config.Config]
+	sources atomic.Pointer[clientinfo.Sources]
+	logger  *slog.Logger
+	tpl     *template.Template
 }
 
 type viewModel struct {
@@ -27,18 +30,22 @@ type viewModel struct {
 	Timestamp string
 }
 
-func newHandler(cfg config.Config, logger *slog.Logger) (http.Handler, error) {
+func newHandler(cfg config.Config, src clientinfo.Sources, logger *slog.Logger) (*handler, error) {
 	tpl, err := templates.Client()
 	if err != nil {
 		return nil, fmt.Errorf("load template: %w", err)
 	}
 
-	return &handler{cfg: cfg, logger: logger, tpl: tpl}, nil
+	h := &handler{logger: logger, tpl: tpl}
+	h.cfg.Store(&cfg)
+	h.sources.Store(&src)
+
+	return h, nil
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	data := clientinfo.Collect(r.Context(), r, h.cfg)
+	data := clientinfo.Collect(r.Context(), r, *h.cfg.Load(), *h.sources.Load())
 	lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
 
 	switch r.URL.Path {
@@ -52,7 +59,13 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(lrw, r)
 	}
 
-	h.logger.Info("request completed",
+	// Watchdog probes would flood the log at the info level.
+	level := slog.LevelInfo
+	if r.Context().Value(probeContextKey{}) != nil {
+		level = slog.LevelDebug
+	}
+
+	h.logger.Log(r.Context(), level, "request completed",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"status", lrw.status,
@@ -40,6 +40,10 @@ func TestJSONEndpoint(t *testing.T) {
 		t.Fatalf("unexpected IP: %s", payload.IPAddress)
 	}
 
+	if class := payload.AddressClass; class == nil || class.Version != 4 || class.Name == nil || *class.Name != "Documentation (TEST-NET-2)" || class.Global {
+		t.Fatalf("unexpected address class: %+v", class)
+	}
+
 	if payload.Locale == nil || payload.PreferredLanguage == nil {
 		t.Fatalf("missing locale data: %+v", payload)
 	}
@@ -216,6 +220,24 @@ func TestHTMLHidesDisabledSections(t *testing.T) {
 	}
 }
 
+func TestHTMLShowsAddressDetails(t *testing.T) {
+	handler := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[fd00::250:56ff:fe01:203]:8080"
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if body := res.Body.String(); !strings.Contains(body, "IPv6 &middot; Unique-Local (fc00::/7, RFC 4193)") {
+		t.Fatal("expected the address class in HTML")
+	}
+
+	if body := res.Body.String(); !strings.Contains(body, "<summary>IPv6 address</summary>") || !strings.Contains(body, "00:50:56:01:02:03 (VMware, Inc.)") {
+		t.Fatal("expected the IPv6 section in HTML")
+	}
+}
+
 func newTestHandler(t *testing.T) http.Handler {
 	t.Helper()
 
@@ -231,7 +253,7 @@ func newTestHandlerWithConfig(t *testing.T, cfg config.Config) http.Handler {
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
-	handler, err := newHandler(cfg, logger)
+	handler, err := newHandler(cfg, clientinfo.Sources{}, logger)
 	if err != nil {
 		t.Fatalf("newHandler: %v", err)
 	}
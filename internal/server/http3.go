@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+// quicListener bundles a QUIC listener with the transport and UDP socket it owns.
+type quicListener struct {
+	*quic.EarlyListener
+
+	transport *quic.Transport
+}
+
+func (l *quicListener) Close() error {
+	err := l.EarlyListener.Close()
+	if closeErr := l.transport.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := l.transport.Conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// newHTTP3Server builds the HTTP/3 server. Each QUIC connection gets the same
+// per-connection state as TCP ones, plus a description of the QUIC transport.
+func newHTTP3Server(handler http.Handler, cfg config.ServerConfig, logger *slog.Logger) *http3.Server {
+	return &http3.Server{
+		Handler:        handler,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		IdleTimeout:    cfg.IdleTimeout,
+		Logger:         logger,
+		ConnContext: func(ctx context.Context, conn *quic.Conn) context.Context {
+			clientinfo.RecordQUICConn(ctx, describeQUICConn(conn))
+
+			return ctx
+		},
+	}
+}
+
+// advertiseHTTP3 announces the HTTP/3 endpoint via Alt-Svc on responses to TLS requests.
+func advertiseHTTP3(next http.Handler, h3 *http3.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && r.ProtoMajor < 3 {
+			_ = h3.SetQUICHeaders(w.Header())
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func describeQUICConn(conn *quic.Conn) func() clientinfo.QUICInfo {
+	initialAddr := conn.RemoteAddr().String()
+
+	return func() clientinfo.QUICInfo {
+		state := conn.ConnectionState()
+		version := state.Version.String()
+		migrated := conn.RemoteAddr().String() != initialAddr
+
+		return clientinfo.QUICInfo{
+			Version:  &version,
+			Used0RTT: &state.Used0RTT,
+			Migrated: &migrated,
+		}
+	}
+}
+
+// http3Addr returns the UDP network and address for HTTP/3, defaulting to those of
+// the first TCP listener serving TLS.
+func http3Addr(cfg config.ServerConfig) (string, string) {
+	if cfg.HTTP3Addr != "" {
+		return "udp", cfg.HTTP3Addr
+	}
+
+	for _, addr := range cfg.TLSListenAddrs() {
+		if network, ok := strings.CutPrefix(addr.Network, "tcp"); ok {
+			return "udp" + network, addr.Address
+		}
+	}
+
+	return "udp", ""
+}
+
+// listenQUIC serves HTTP/3 on the inherited UDP sockets, or binds the configured
+// address when there are none.
+func (a *App) listenQUIC(ctx context.Context, conns []net.PacketConn) ([]*quicListener, error) {
+	if len(conns) == 0 {
+		network, addr := http3Addr(a.cfg.Server)
+
+		var lc net.ListenConfig
+
+		conn, err := lc.ListenPacket(ctx, network, addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen on %s/%s: %w", addr, network, err)
+		}
+
+		conns = append(conns, conn)
+	}
+
+	listeners := make([]*quicListener, 0, len(conns))
+
+	for i, conn := range conns {
+		ln, err := a.newQUICListener(conn)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+
+			for _, pending := range conns[i+1:] {
+				_ = pending.Close()
+			}
+
+			return nil, err
+		}
+
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+// newQUICListener starts accepting QUIC connections on conn, taking ownership of it.
+func (a *App) newQUICListener(conn net.PacketConn) (*quicListener, error) {
+	transport := &quic.Transport{
+		Conn: conn,
+		ConnContext: func(ctx context.Context, _ *quic.ClientInfo) (context.Context, error) {
+			return clientinfo.NewConnContext(ctx), nil
+		},
+	}
+
+	ln, err := transport.ListenEarly(http3.ConfigureTLSConfig(a.httpServer.TLSConfig), &quic.Config{
+		Allow0RTT:      a.cfg.Server.HTTP3Allow0RTT,
+		MaxIdleTimeout: a.cfg.Server.IdleTimeout,
+	})
+	if err != nil {
+		_ = transport.Close()
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("listen QUIC on %s: %w", conn.LocalAddr(), err)
+	}
+
+	a.trackSocket(socketNameHTTP3, conn)
+
+	a.logger.Info("server listening", "addr", ln.Addr().String(), "http3", true, "0rtt", a.cfg.Server.HTTP3Allow0RTT)
+
+	return &quicListener{EarlyListener: ln, transport: transport}, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestHTTP3(t *testing.T) {
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Server.HTTP3 = true
+	cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile = writeTestCertificate(t, t.TempDir(), "localhost")
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	conn, err := lc.ListenPacket(context.Background(), "udp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("listen UDP: %v", err)
+	}
+
+	quicLn, err := app.newQUICListener(conn)
+	if err != nil {
+		t.Fatalf("listen QUIC: %v", err)
+	}
+
+	go func() {
+		_ = app.httpServer.Serve(tls.NewListener(ln, app.httpServer.TLSConfig))
+	}()
+
+	go func() {
+		_ = app.http3Server.ServeListener(quicLn)
+	}()
+
+	t.Cleanup(func() {
+		_ = app.httpServer.Close()
+		_ = app.http3Server.Close()
+		_ = quicLn.Close()
+	})
+
+	clientTLS := &tls.Config{InsecureSkipVerify: true} //nolint:gosec // Self-signed test certificate.
+	url := "https://" + ln.Addr().String() + "/json"
+
+	t.Run("Alt-Svc advertised over TCP", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer res.Body.Close()
+
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		if altSvc := res.Header.Get("Alt-Svc"); !strings.Contains(altSvc, `h3=":`+port+`"`) {
+			t.Fatalf("unexpected Alt-Svc: %q", altSvc)
+		}
+	})
+
+	t.Run("request over QUIC", func(t *testing.T) {
+		transport := &http3.Transport{TLSClientConfig: clientTLS}
+		t.Cleanup(func() { _ = transport.Close() })
+
+		payload := fetchJSON(t, &http.Client{Transport: transport}, url)
+
+		if payload.Connection == nil || payload.Connection.Protocol == nil || *payload.Connection.Protocol != "HTTP/3.0" {
+			t.Fatalf("unexpected connection info: %+v", payload.Connection)
+		}
+
+		quic := payload.Connection.QUIC
+		if quic == nil || quic.Version == nil || *quic.Version != "v1" {
+			t.Fatalf("unexpected QUIC info: %+v", quic)
+		}
+
+		if quic.Used0RTT == nil || *quic.Used0RTT || quic.Migrated == nil || *quic.Migrated {
+			t.Fatalf("expected fresh, unmigrated connection: %+v", quic)
+		}
+
+		if payload.TLS == nil || payload.TLS.JA4 == nil || !strings.HasPrefix(*payload.TLS.JA4, "q13") {
+			t.Fatalf("unexpected TLS info: %+v", payload.TLS)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+
+	proxyproto "github.com/pires/go-proxyproto"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+// wrapProxyProtocol makes the listener parse PROXY protocol v1/v2 headers so that
+// the original client address is reported by the accepted connections.
+func wrapProxyProtocol(ln net.Listener, cfg config.ServerConfig) net.Listener {
+	return &proxyproto.Listener{
+		Listener:          ln,
+		Policy:            proxyProtocolPolicy(cfg.ProxyProtocolSubnets),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+	}
+}
+
+// proxyProtocolPolicy accepts PROXY headers only from trusted peers. Untrusted peers
+// may still connect directly, but a connection carrying a header from them is rejected.
+func proxyProtocolPolicy(subnets []netip.Prefix) proxyproto.PolicyFunc {
+	return func(upstream net.Addr) (proxyproto.Policy, error) {
+		if len(subnets) == 0 {
+			return proxyproto.USE, nil
+		}
+
+		tcpAddr, ok := upstream.(*net.TCPAddr)
+		if !ok {
+			return proxyproto.REJECT, nil
+		}
+
+		ip := tcpAddr.AddrPort().Addr().Unmap()
+		for _, prefix := range subnets {
+			if prefix.Contains(ip) {
+				return proxyproto.USE, nil
+			}
+		}
+
+		return proxyproto.REJECT, nil
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestProxyProtocolListener(t *testing.T) {
+	t.Run("header from trusted peer sets client address", func(t *testing.T) {
+		cfg := config.Default().Server
+		cfg.ProxyProtocolSubnets = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+
+		addr := serveWithProxyProtocol(t, cfg)
+
+		body, err := proxiedPlainRequest(t, addr, "PROXY TCP4 198.51.100.7 203.0.113.1 51000 80\r\n")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+
+		if body != "198.51.100.7" {
+			t.Fatalf("expected address from PROXY header, got %q", body)
+		}
+	})
+
+	t.Run("v2 header accepted", func(t *testing.T) {
+		addr := serveWithProxyProtocol(t, config.Default().Server)
+
+		header := "\r\n\r\n\x00\r\nQUIT\n" + // signature
+			"\x21\x11\x00\x0c" + // PROXY command, TCP over IPv4, 12 bytes of addresses
+			"\xc6\x33\x64\x08" + "\xcb\x00\x71\x01" + // 198.51.100.8 -> 203.0.113.1
+			"\xc7\x38" + "\x00\x50" // 51000 -> 80
+
+		body, err := proxiedPlainRequest(t, addr, header)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+
+		if body != "198.51.100.8" {
+			t.Fatalf("expected address from PROXY v2 header, got %q", body)
+		}
+	})
+
+	t.Run("connection without header keeps peer address", func(t *testing.T) {
+		addr := serveWithProxyProtocol(t, config.Default().Server)
+
+		body, err := proxiedPlainRequest(t, addr, "")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+
+		if body != "127.0.0.1" {
+			t.Fatalf("expected peer address, got %q", body)
+		}
+	})
+
+	t.Run("header from untrusted peer rejected", func(t *testing.T) {
+		cfg := config.Default().Server
+		cfg.ProxyProtocolSubnets = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+		addr := serveWithProxyProtocol(t, cfg)
+
+		body, err := proxiedPlainRequest(t, addr, "PROXY TCP4 198.51.100.7 203.0.113.1 51000 80\r\n")
+		if err == nil && body == "198.51.100.7" {
+			t.Fatalf("PROXY header from untrusted peer was honored")
+		}
+	})
+}
+
+func serveWithProxyProtocol(t *testing.T, cfg config.ServerConfig) string {
+	t.Helper()
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := &http.Server{
+		Handler:           newTestHandler(t),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	go func() {
+		_ = srv.Serve(wrapProxyProtocol(ln, cfg))
+	}()
+
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	return ln.Addr().String()
+}
+
+func proxiedPlainRequest(t *testing.T, addr, header string) (string, error) {
+	t.Helper()
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+
+	if _, err := io.WriteString(conn, header+"GET /plain HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+// liveSections are the configuration sections applied to the running server on
+// reload. Other settings only take effect after a restart or an upgrade.
+var liveSections = []string{"proxy", "resolver", "metadata"}
+
+// EnableConfigReload makes the server re-read its configuration with load on SIGHUP
+// and, when path is not empty and ConfigReloadInterval is positive, whenever that
+// file changes.
+func (a *App) EnableConfigReload(load func() (config.Config, error), path string) {
+	a.loadConfig = load
+	a.configPath = path
+}
+
+// reloadConfig loads the configuration and applies the live sections. An invalid
+// configuration is rejected and the current one stays in effect.
+func (a *App) reloadConfig() {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	updated, err := a.loadConfig()
+	if err != nil {
+		a.logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+
+		return
+	}
+
+	// Subnet files are re-read on every reload, not only when their list changes.
+	src := a.bindSources(updated.Proxy)
+
+	if err := a.loadTrustedSubnets(updated.Proxy, src); err != nil {
+		a.logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+
+		return
+	}
+
+	current := *a.handler.cfg.Load()
+
+	changes := config.Diff(current, updated)
+	if len(changes) == 0 {
+		a.logger.Info("configuration reloaded, nothing changed")
+
+		return
+	}
+
+	for _, change := range changes {
+		if slices.Contains(liveSections, change.Section) {
+			a.logger.Info("configuration changed", "key", change.Key, "old", change.Old, "new", change.New)
+		} else {
+			a.logger.Warn("configuration change requires a restart", "key", change.Key, "old", change.Old, "new", change.New)
+		}
+	}
+
+	applied := current
+	applied.Proxy = updated.Proxy
+	applied.Resolver = updated.Resolver
+	applied.Metadata = updated.Metadata
+
+	a.handler.sources.Store(&src)
+	a.handler.cfg.Store(&applied)
+
+	select {
+	case a.proxyReloaded <- struct{}{}:
+	default:
+	}
+}
+
+// watchConfig polls the configuration file and reloads it when it changes, until
+// the context is canceled.
+func (a *App) watchConfig(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	stamp, err := statFile(a.configPath)
+	if err != nil {
+		a.logger.Warn("cannot watch configuration file", "error", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := statFile(a.configPath)
+			if err != nil {
+				a.logger.Error("configuration file check failed", "error", err)
+
+				continue
+			}
+
+			if current == stamp {
+				continue
+			}
+
+			stamp = current
+
+			a.reloadConfig()
+		}
+	}
+}
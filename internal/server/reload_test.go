@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestReloadConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var (
+		next    config.Config
+		loadErr error
+	)
+
+	app.EnableConfigReload(func() (config.Config, error) { return next, loadErr }, "")
+
+	userAgent := func() *string {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/json", nil)
+		req.Header.Set("User-Agent", "reload-test")
+
+		res := httptest.NewRecorder()
+		app.httpServer.Handler.ServeHTTP(res, req)
+
+		var payload clientinfo.Data
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+
+		return payload.UserAgent
+	}
+
+	if userAgent() == nil {
+		t.Fatal("expected the user agent before reload")
+	}
+
+	next = cfg
+	next.Metadata.IncludeUserAgent = false
+	next.Server.ReadTimeout = 2 * cfg.Server.ReadTimeout
+
+	app.reloadConfig()
+
+	if ua := userAgent(); ua != nil {
+		t.Fatalf("expected the reloaded config to hide the user agent, got %q", *ua)
+	}
+
+	if got := app.handler.cfg.Load().Server.ReadTimeout; got != cfg.Server.ReadTimeout {
+		t.Fatalf("server settings must not change on reload, got read timeout %v", got)
+	}
+
+	next.Metadata.IncludeUserAgent = true
+	loadErr = errors.New("invalid configuration")
+
+	app.reloadConfig()
+
+	if ua := userAgent(); ua != nil {
+		t.Fatal("expected a failed reload to keep the current config")
+	}
+}
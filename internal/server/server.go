@@ -3,70 +3,437 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
 	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/ipdb"
+	"git.skobk.in/skobkin/ip-detect/internal/subnets"
+	"git.skobk.in/skobkin/ip-detect/internal/systemd"
 )
 
 // App wraps the HTTP server lifecycle.
 type App struct {
-	cfg        config.Config
-	logger     *slog.Logger
-	httpServer *http.Server
+	cfg         config.Config
+	logger      *slog.Logger
+	httpServer  *http.Server
+	http3Server *http3.Server
+	handler     *handler
+	certs       *certReloader
+	sockets     []handoverSocket
+
+	// loadConfig and configPath are set by EnableConfigReload.
+	loadConfig func() (config.Config, error)
+	configPath string
+	reloadMu   sync.Mutex
+
+	// fileSubnets and providerSubnets, keyed by file, are shared by the sources
+	// of every configuration the handler uses; proxyReloaded wakes the refresh
+	// loop after a configuration reload.
+	fileSubnets     *subnets.List
+	providerSubnets map[string]*subnets.List
+	proxyReloaded   chan struct{}
+
+	// databases are the enrichment databases, reloaded when their files change;
+	// geoIP and asn are the ones that are configured.
+	databases []ipdb.Database
+	geoIP     *ipdb.GeoDB
+	asn       *ipdb.ASNDB
 }
 
 // New constructs a server with routes configured.
 func New(cfg config.Config, logger *slog.Logger) (*App, error) {
-	handler, err := newHandler(cfg, logger)
+	app := &App{
+		logger:          logger,
+		fileSubnets:     &subnets.List{},
+		providerSubnets: make(map[string]*subnets.List),
+		proxyReloaded:   make(chan struct{}, 1),
+	}
+
+	if err := app.openDatabases(cfg.Enrichment); err != nil {
+		return nil, err
+	}
+
+	src := app.bindSources(cfg.Proxy)
+
+	if err := app.loadTrustedSubnets(cfg.Proxy, src); err != nil {
+		return nil, err
+	}
+
+	handler, err := newHandler(cfg, src, logger)
 	if err != nil {
 		return nil, err
 	}
 
 	srv := &http.Server{
-		Addr:              cfg.Server.Addr,
 		Handler:           handler,
 		ReadTimeout:       cfg.Server.ReadTimeout,
 		WriteTimeout:      cfg.Server.WriteTimeout,
 		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
 		IdleTimeout:       cfg.Server.IdleTimeout,
 		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return clientinfo.NewConnContext(ctx)
+		},
+	}
+
+	app.cfg = cfg
+	app.httpServer = srv
+	app.handler = handler
+
+	switch {
+	case cfg.Server.ACMEEnabled():
+		manager, err := newACMEManager(cfg.Server)
+		if err != nil {
+			return nil, err
+		}
+
+		// HTTP-01 needs a plain HTTP listener; without one only TLS-ALPN-01 is offered.
+		if len(cfg.Server.TLSAddrs) > 0 {
+			srv.Handler = manager.HTTPHandler(handler)
+		}
+
+		srv.TLSConfig = newTLSConfig(manager.GetCertificate)
+		srv.TLSConfig.NextProtos = append(srv.TLSConfig.NextProtos, acme.ALPNProto)
+	case cfg.Server.TLSEnabled():
+		app.certs, err = newCertReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		srv.TLSConfig = newTLSConfig(app.certs.GetCertificate)
 	}
 
-	return &App{cfg: cfg, logger: logger, httpServer: srv}, nil
+	if srv.TLSConfig != nil {
+		if err := configureClientAuth(srv.TLSConfig, cfg.Server); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Server.HTTP3 && srv.TLSConfig != nil {
+		app.http3Server = newHTTP3Server(handler, cfg.Server, logger)
+		srv.Handler = advertiseHTTP3(srv.Handler, app.http3Server)
+	}
+
+	if cfg.Server.H2C {
+		enableH2C(srv, cfg.Server)
+	}
+
+	return app, nil
 }
 
 // Run starts the HTTP server and blocks until shutdown.
 func (a *App) Run(ctx context.Context) error {
-	serverErr := make(chan error, 1)
+	listeners, packetConns, err := a.listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.certs != nil {
+		go a.certs.watch(ctx, a.cfg.Server.TLSReloadInterval)
+	}
 
-	go func() {
-		a.logger.Info("server listening", "addr", a.cfg.Server.Addr)
+	if a.certs != nil || a.loadConfig != nil || len(a.databases) > 0 {
+		go a.reloadOnHangup(ctx)
+	}
 
-		if err := a.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			serverErr <- err
+	if len(a.databases) > 0 {
+		go a.watchDatabases(ctx, a.cfg.Enrichment.DBReloadInterval)
+	}
 
-			return
+	go a.refreshTrustedSubnets(ctx)
+
+	if a.loadConfig != nil && a.configPath != "" {
+		go a.watchConfig(ctx, a.cfg.Server.ConfigReloadInterval)
+	}
+
+	serve := make([]func() error, 0, len(listeners)+len(packetConns)+1)
+	for _, ln := range listeners {
+		serve = append(serve, func() error { return a.httpServer.Serve(ln) })
+	}
+
+	if a.http3Server != nil {
+		quicLns, err := a.listenQUIC(ctx, packetConns)
+		if err != nil {
+			closeListeners(listeners)
+
+			return err
 		}
 
-		serverErr <- nil
-	}()
+		for _, ln := range quicLns {
+			// http3.Server never closes the listeners it serves.
+			defer func() { _ = ln.Close() }()
+
+			serve = append(serve, func() error { return a.http3Server.ServeListener(ln) })
+		}
+	}
+
+	serverErr := make(chan error, len(serve))
+
+	for _, fn := range serve {
+		go func() {
+			if err := fn(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+
+				return
+			}
+
+			serverErr <- nil
+		}()
+	}
+
+	a.notify(systemd.Ready)
+	signalUpgradeReady()
+
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		watchdogCtx, stopWatchdog := context.WithCancel(ctx)
+		defer stopWatchdog()
+
+		go a.pingWatchdog(watchdogCtx, interval)
+	}
+
+	upgrade := make(chan os.Signal, 1)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(upgrade, upgradeSignals...)
+		defer signal.Stop(upgrade)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.logger.Info("shutting down")
+			a.notify(systemd.Stopping)
+
+			if err := a.shutdown(ctx); err != nil {
+				return err
+			}
+
+			return waitServers(serverErr, len(serve))
+		case <-upgrade:
+			a.logger.Info("upgrading, starting new process")
 
-	select {
-	case <-ctx.Done():
-		shutdownCtx, cancel := context.WithTimeout(ctx, a.cfg.Server.ShutdownTimeout)
-		defer cancel()
+			if err := a.upgrade(ctx); err != nil {
+				a.logger.Error("upgrade failed, continuing to serve", "error", err)
 
-		a.logger.Info("shutting down")
+				continue
+			}
 
-		if err := a.httpServer.Shutdown(shutdownCtx); err != nil {
-			return fmt.Errorf("server shutdown: %w", err)
+			// The new process reads from the same UDP sockets; QUIC connections cannot be
+			// drained here because their packets may arrive at either process.
+			if a.http3Server != nil {
+				_ = a.http3Server.Close()
+			}
+
+			a.logger.Info("handed over listeners, draining")
+
+			if err := a.shutdown(ctx); err != nil {
+				return err
+			}
+
+			return waitServers(serverErr, len(serve))
+		case err := <-serverErr:
+			a.notify(systemd.Stopping)
+
+			_ = a.httpServer.Close()
+			if a.http3Server != nil {
+				_ = a.http3Server.Close()
+			}
+
+			return err
 		}
+	}
+}
 
-		return <-serverErr
-	case err := <-serverErr:
-		return err
+// shutdown stops accepting connections and waits up to ShutdownTimeout for
+// in-flight requests. The drain deliberately outlives the cancellation of ctx.
+func (a *App) shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("server shutdown: %w", err)
+	}
+
+	if a.http3Server != nil {
+		if err := a.http3Server.Shutdown(ctx); err != nil {
+			return fmt.Errorf("http3 server shutdown: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// listen opens the stream listeners for HTTP/1.1 and HTTP/2, and returns any UDP
+// sockets inherited for HTTP/3. Sockets passed by systemd replace the configured addresses.
+func (a *App) listen(ctx context.Context) ([]net.Listener, []net.PacketConn, error) {
+	if files := upgradeFiles(); len(files) > 0 {
+		return a.inheritListeners(files)
+	}
+
+	if files := systemd.ListenFiles(); len(files) > 0 {
+		return a.inheritListeners(files)
+	}
+
+	type binding struct {
+		addr config.ListenAddr
+		tls  bool
+	}
+
+	tlsEnabled := a.httpServer.TLSConfig != nil
+	separateTLS := tlsEnabled && len(a.cfg.Server.TLSAddrs) > 0
+
+	bindings := make([]binding, 0, len(a.cfg.Server.Addrs)+len(a.cfg.Server.TLSAddrs))
+	for _, addr := range a.cfg.Server.Addrs {
+		bindings = append(bindings, binding{addr: addr, tls: tlsEnabled && !separateTLS})
+	}
+
+	if separateTLS {
+		for _, addr := range a.cfg.Server.TLSAddrs {
+			bindings = append(bindings, binding{addr: addr, tls: true})
+		}
+	}
+
+	listeners := make([]net.Listener, 0, len(bindings))
+
+	for _, b := range bindings {
+		ln, err := a.listenAddr(ctx, b.addr)
+		if err != nil {
+			closeListeners(listeners)
+
+			return nil, nil, err
+		}
+
+		listeners = append(listeners, a.serveListener(ln, b.tls))
+	}
+
+	return listeners, nil, nil
+}
+
+// serveListener prepares a bound socket for serving: it is remembered for handover on
+// upgrade, wrapped for the PROXY protocol and TLS as configured, and logged.
+func (a *App) serveListener(ln net.Listener, withTLS bool) net.Listener {
+	name := socketNameHTTP
+	if withTLS {
+		name = socketNameHTTPS
+	}
+
+	a.trackSocket(name, ln)
+
+	network := ln.Addr().Network()
+
+	if a.cfg.Server.ProxyProtocol {
+		ln = wrapProxyProtocol(ln, a.cfg.Server)
+	}
+
+	if withTLS {
+		ln = tls.NewListener(ln, a.httpServer.TLSConfig)
+	}
+
+	a.logger.Info("server listening", "network", network, "addr", ln.Addr().String(), "tls", withTLS, "proxy_protocol", a.cfg.Server.ProxyProtocol)
+
+	return ln
+}
+
+func (a *App) listenAddr(ctx context.Context, addr config.ListenAddr) (net.Listener, error) {
+	var (
+		ln  net.Listener
+		err error
+	)
+
+	if addr.Network == "unix" {
+		ln, err = a.listenUnix(ctx, addr.Address)
+	} else {
+		var lc net.ListenConfig
+
+		ln, err = lc.Listen(ctx, addr.Network, addr.Address)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	return ln, nil
+}
+
+// reloadOnHangup re-reads the certificate pair and the configuration whenever the
+// process receives SIGHUP.
+func (a *App) reloadOnHangup(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if a.certs != nil {
+				if err := a.certs.Reload(); err != nil {
+					a.logger.Error("certificate reload failed", "error", err)
+				} else {
+					a.logger.Info("certificate reloaded", "cert", a.cfg.Server.TLSCertFile, "key", a.cfg.Server.TLSKeyFile)
+				}
+			}
+
+			a.reloadDatabases()
+
+			if a.loadConfig != nil {
+				a.reloadConfig()
+			}
+		}
+	}
+}
+
+func waitServers(serverErr <-chan error, count int) error {
+	var firstErr error
+
+	for range count {
+		if err := <-serverErr; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+}
+
+// newTLSConfig builds the server TLS configuration around a certificate source.
+// Every ClientHello and served certificate is recorded so that requests can report the
+// client's TLS fingerprint and the stapling state of the handshake.
+func newTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := getCertificate(hello)
+			if err == nil {
+				clientinfo.RecordServedCertificate(hello, cert)
+			}
+
+			return cert, err
+		},
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			clientinfo.RecordClientHello(hello)
+
+			return nil, nil
+		},
 	}
 }
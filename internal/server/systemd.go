@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/systemd"
+)
+
+var errProbeStatus = errors.New("probe request failed with status")
+
+// inheritListeners turns sockets passed by systemd into listeners. Stream sockets named
+// "https" serve TLS, other stream sockets are treated like IPD_ADDR entries, and datagram
+// sockets carry HTTP/3.
+func (a *App) inheritListeners(files []*os.File) ([]net.Listener, []net.PacketConn, error) {
+	tlsEnabled := a.httpServer.TLSConfig != nil
+	separateTLS := tlsEnabled && slices.ContainsFunc(files, func(f *os.File) bool {
+		return f.Name() == socketNameHTTPS
+	})
+
+	var (
+		listeners   []net.Listener
+		packetConns []net.PacketConn
+	)
+
+	closeAll := func() {
+		closeListeners(listeners)
+
+		for _, conn := range packetConns {
+			_ = conn.Close()
+		}
+	}
+
+	// The net package duplicates the descriptors, so the originals are always closed.
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	for _, f := range files {
+		if ln, err := net.FileListener(f); err == nil {
+			withTLS := f.Name() == socketNameHTTPS || (tlsEnabled && !separateTLS)
+			if withTLS && !tlsEnabled {
+				_ = ln.Close()
+				closeAll()
+
+				return nil, nil, fmt.Errorf("socket %q requires TLS to be configured", f.Name())
+			}
+
+			listeners = append(listeners, a.serveListener(ln, withTLS))
+
+			continue
+		}
+
+		conn, err := net.FilePacketConn(f)
+		if err != nil {
+			closeAll()
+
+			return nil, nil, fmt.Errorf("use socket %q passed by systemd: %w", f.Name(), err)
+		}
+
+		if a.http3Server == nil {
+			_ = conn.Close()
+
+			a.logger.Warn("ignoring datagram socket passed by systemd, HTTP/3 is disabled", "name", f.Name())
+
+			continue
+		}
+
+		packetConns = append(packetConns, conn)
+	}
+
+	return listeners, packetConns, nil
+}
+
+func (a *App) notify(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		a.logger.Warn("systemd notification failed", "state", state, "error", err)
+	}
+}
+
+// pingWatchdog keeps the systemd watchdog satisfied at half its interval while the
+// server is serving; ctx ends when shutdown begins or a listener fails. A ping is
+// only sent after a request served in process succeeds, so a stuck handler lets the
+// watchdog fire.
+func (a *App) pingWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.probeHandler(ctx, interval/4); err != nil {
+				a.logger.Warn("health check failed, skipping watchdog ping", "error", err)
+
+				continue
+			}
+
+			a.notify(systemd.Watchdog)
+		}
+	}
+}
+
+// probeContextKey marks requests made by probeHandler.
+type probeContextKey struct{}
+
+// probeHandler serves a request for /plain through the server's handler chain and
+// waits up to timeout for a successful response. A probe stuck in the handler is
+// abandoned.
+func (a *App) probeHandler(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, probeContextKey{}, true), timeout)
+	defer cancel()
+
+	// Without a remote address no reverse DNS lookup is made for the probe.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/plain", nil)
+	if err != nil {
+		return fmt.Errorf("create probe request: %w", err)
+	}
+
+	res := &probeResponse{header: make(http.Header)}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		a.httpServer.Handler.ServeHTTP(res, req)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("probe request: %w", ctx.Err())
+	}
+
+	if res.status != http.StatusOK {
+		return fmt.Errorf("%w: %d", errProbeStatus, res.status)
+	}
+
+	return nil
+}
+
+// probeResponse records the status of a probe response and discards its body.
+type probeResponse struct {
+	header http.Header
+	status int
+}
+
+func (r *probeResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *probeResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	return len(b), nil
+}
+
+func (r *probeResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
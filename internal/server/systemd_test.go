@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/systemd"
+)
+
+func TestInheritListeners(t *testing.T) {
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var lc net.ListenConfig
+
+	tcp, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen TCP: %v", err)
+	}
+	defer tcp.Close()
+
+	udp, err := lc.ListenPacket(context.Background(), "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen UDP: %v", err)
+	}
+	defer udp.Close()
+
+	tcpFile, err := tcp.(*net.TCPListener).File() //nolint:forcetypeassert // Listen("tcp") returns a TCP listener.
+	if err != nil {
+		t.Fatalf("TCP file: %v", err)
+	}
+
+	udpFile, err := udp.(*net.UDPConn).File() //nolint:forcetypeassert // ListenPacket("udp") returns a UDP conn.
+	if err != nil {
+		t.Fatalf("UDP file: %v", err)
+	}
+
+	listeners, packetConns, err := app.inheritListeners([]*os.File{tcpFile, udpFile})
+	if err != nil {
+		t.Fatalf("inherit: %v", err)
+	}
+
+	// HTTP/3 is disabled, so the datagram socket is closed instead of served.
+	if len(listeners) != 1 || len(packetConns) != 0 {
+		t.Fatalf("unexpected listeners: %d stream, %d datagram", len(listeners), len(packetConns))
+	}
+
+	go func() {
+		_ = app.httpServer.Serve(listeners[0])
+	}()
+
+	t.Cleanup(func() {
+		_ = app.httpServer.Close()
+	})
+
+	payload := fetchJSON(t, http.DefaultClient, "http://"+tcp.Addr().String()+"/json")
+	if payload.IPAddress != "127.0.0.1" {
+		t.Fatalf("unexpected client IP: %q", payload.IPAddress)
+	}
+}
+
+func TestPingWatchdogProbesHandler(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	const interval = 40 * time.Millisecond
+
+	ping := func() bool {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			app.pingWatchdog(ctx, interval)
+		}()
+
+		_ = conn.SetReadDeadline(time.Now().Add(3 * interval))
+
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+
+		cancel()
+		<-done
+
+		return err == nil && string(buf[:n]) == systemd.Watchdog
+	}
+
+	if !ping() {
+		t.Fatal("expected a watchdog ping while the handler responds")
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	app.httpServer.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	})
+
+	if ping() {
+		t.Fatal("expected no watchdog ping while the handler is stuck")
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestTLSReportsClientHello(t *testing.T) {
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+
+	payload := fetchJSONOverTLS(t, cfg, &tls.Config{InsecureSkipVerify: true}) //nolint:gosec // Self-signed test certificate.
+
+	if payload.TLS == nil || payload.TLS.Source == nil || *payload.TLS.Source != "direct" {
+		t.Fatalf("missing direct TLS data: %+v", payload.TLS)
+	}
+
+	if payload.TLS.JA4 == nil || !strings.HasPrefix(*payload.TLS.JA4, "t13i") {
+		t.Fatalf("unexpected JA4: %v", payload.TLS.JA4)
+	}
+
+	if payload.TLS.JA3Hash == nil || len(*payload.TLS.JA3Hash) != 32 {
+		t.Fatalf("unexpected JA3 hash: %v", payload.TLS.JA3Hash)
+	}
+
+	if payload.TLS.ClientHello == nil || len(payload.TLS.ClientHello.CipherSuites) == 0 {
+		t.Fatalf("missing ClientHello details: %+v", payload.TLS.ClientHello)
+	}
+}
+
+func TestTLSReportsSessionState(t *testing.T) {
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+
+	addr := serveTLS(t, cfg)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{ //nolint:gosec // Self-signed test certificate.
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		},
+		DisableKeepAlives: true,
+	}}
+
+	first := fetchJSON(t, client, "https://"+addr+"/json")
+	if first.TLS == nil {
+		t.Fatalf("missing TLS data")
+	}
+
+	if first.TLS.KeyExchange == nil {
+		t.Fatalf("missing key exchange group")
+	}
+
+	if first.TLS.EarlyData != nil {
+		t.Fatalf("expected no early_data over TCP, got %v", *first.TLS.EarlyData)
+	}
+
+	for name, value := range map[string]*bool{
+		"resumed":      first.TLS.Resumed,
+		"ech_accepted": first.TLS.ECHAccepted,
+		"ocsp_stapled": first.TLS.OCSPStapled,
+		"sct_stapled":  first.TLS.SCTStapled,
+	} {
+		if value == nil || *value {
+			t.Fatalf("expected %s=false on first handshake, got %v", name, value)
+		}
+	}
+
+	second := fetchJSON(t, client, "https://"+addr+"/json")
+	if second.TLS == nil || second.TLS.Resumed == nil || !*second.TLS.Resumed {
+		t.Fatalf("expected resumed session on second connection: %+v", second.TLS)
+	}
+}
+
+func fetchJSONOverTLS(t *testing.T, cfg config.Config, clientTLS *tls.Config) clientinfo.Data {
+	t.Helper()
+
+	addr := serveTLS(t, cfg)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS, ForceAttemptHTTP2: true}}
+
+	return fetchJSON(t, client, "https://"+addr+"/json")
+}
+
+// serveTLS serves the app over TLS with a fresh self-signed certificate and returns its address.
+func serveTLS(t *testing.T, cfg config.Config) string {
+	t.Helper()
+
+	cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile = writeTestCertificate(t, t.TempDir(), "localhost")
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	go func() {
+		_ = app.httpServer.Serve(tls.NewListener(ln, app.httpServer.TLSConfig))
+	}()
+
+	t.Cleanup(func() {
+		_ = app.httpServer.Close()
+	})
+
+	return ln.Addr().String()
+}
+
+func fetchJSON(t *testing.T, client *http.Client, url string) clientinfo.Data {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer res.Body.Close()
+
+	var payload clientinfo.Data
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+
+	return payload
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/clientinfo"
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/subnets"
+)
+
+// bindSources returns the sources the handler uses with proxy: the shared trusted
+// subnet list, a list per provider range file and the databases. Provider range
+// files get a list of their own the first time they are seen and keep it, so that
+// refreshes reach every configuration. The map is built anew, as requests read the
+// current one without locking.
+func (a *App) bindSources(proxy config.ProxyConfig) clientinfo.Sources {
+	src := clientinfo.Sources{
+		TrustedSubnets:  a.fileSubnets,
+		ProviderSubnets: make(map[string]*subnets.List),
+		GeoIP:           a.geoIP,
+		ASN:             a.asn,
+	}
+
+	for _, provider := range proxy.Providers() {
+		list, ok := a.providerSubnets[provider.File]
+		if !ok {
+			list = &subnets.List{}
+			a.providerSubnets[provider.File] = list
+		}
+
+		src.ProviderSubnets[provider.File] = list
+	}
+
+	return src
+}
+
+// loadTrustedSubnets reads the trusted subnet files and the provider range files of
+// proxy into the lists of src, which requests read without locking. All current
+// lists are kept if any file fails.
+func (a *App) loadTrustedSubnets(proxy config.ProxyConfig, src clientinfo.Sources) error {
+	prefixes, err := subnets.ReadFiles(proxy.TrustedSubnetFiles)
+	if err != nil {
+		return fmt.Errorf("load trusted subnets: %w", err)
+	}
+
+	providers := proxy.Providers()
+	ranges := make([][]netip.Prefix, len(providers))
+
+	for i, provider := range providers {
+		ranges[i], err = subnets.ReadFiles([]string{provider.File})
+		if err != nil {
+			return fmt.Errorf("load %s ranges: %w", provider.Name, err)
+		}
+	}
+
+	if !slices.Equal(prefixes, src.TrustedSubnets.Load()) {
+		src.TrustedSubnets.Store(prefixes)
+		a.logger.Info("trusted subnets loaded", "files", proxy.TrustedSubnetFiles, "prefixes", len(prefixes))
+	}
+
+	for i, provider := range providers {
+		if list := src.ProviderSubnets[provider.File]; !slices.Equal(ranges[i], list.Load()) {
+			list.Store(ranges[i])
+			a.logger.Info("provider ranges loaded", "provider", provider.Name, "file", provider.File, "prefixes", len(ranges[i]))
+		}
+	}
+
+	return nil
+}
+
+// refreshTrustedSubnets re-reads the trusted subnet and provider range files every
+// TrustedSubnetsRefresh until the context is canceled. The interval is re-read after
+// configuration reloads.
+func (a *App) refreshTrustedSubnets(ctx context.Context) {
+	for {
+		// A stopped timer never fires, which disables refreshing until the next reload.
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+
+		if interval := a.handler.cfg.Load().Proxy.TrustedSubnetsRefresh; interval > 0 {
+			timer.Reset(interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case <-a.proxyReloaded:
+			timer.Stop()
+		case <-timer.C:
+			a.reloadMu.Lock()
+
+			if err := a.loadTrustedSubnets(a.handler.cfg.Load().Proxy, *a.handler.sources.Load()); err != nil {
+				a.logger.Error("trusted subnets refresh failed, keeping the current list", "error", err)
+			}
+
+			a.reloadMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestTrustedSubnetFilesRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdn.txt")
+	writeSubnetFile(t, path, "# CDN edges\n192.0.2.0/24\n")
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Proxy.TrustForwarded = true
+	cfg.Proxy.TrustedSubnetFiles = []string{path}
+	cfg.Proxy.TrustedSubnetsRefresh = 10 * time.Millisecond
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	clientIP := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/plain", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+		res := httptest.NewRecorder()
+		app.httpServer.Handler.ServeHTTP(res, req)
+
+		return strings.TrimSpace(res.Body.String())
+	}
+
+	if got := clientIP(); got != "198.51.100.1" {
+		t.Fatalf("expected the untrusted peer address, got %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go app.refreshTrustedSubnets(ctx)
+
+	writeSubnetFile(t, path, "192.0.2.0/24\n198.51.100.0/24\n")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for clientIP() != "203.0.113.7" {
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed subnet file was not applied")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A broken file keeps the last good list.
+	writeSubnetFile(t, path, "198.51.100.0/33\n")
+	time.Sleep(50 * time.Millisecond)
+
+	if got := clientIP(); got != "203.0.113.7" {
+		t.Fatalf("expected the previous list to stay in effect, got %s", got)
+	}
+}
+
+func TestTrustedSubnetFilesInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdn.txt")
+	writeSubnetFile(t, path, "192.0.2.0/24\nbogus\n")
+
+	cfg := config.Default()
+	cfg.Proxy.TrustedSubnetFiles = []string{path}
+
+	if _, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil || !strings.Contains(err.Error(), path+":2: ") {
+		t.Fatalf("expected an error naming the file and line, got %v", err)
+	}
+}
+
+func writeSubnetFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write subnet file: %v", err)
+	}
+}
+
+func TestProviderRangeFiles(t *testing.T) {
+	dir := t.TempDir()
+	ranges := filepath.Join(dir, "cloudflare.txt")
+	writeSubnetFile(t, ranges, "173.245.48.0/20\n")
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Proxy.Presets = []config.ClientIPProvider{{Name: "cloudflare", Header: "CF-Connecting-IP", File: ranges}}
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/plain", nil)
+	req.RemoteAddr = "173.245.49.1:1234"
+	req.Header.Set("CF-Connecting-IP", "203.0.113.7")
+
+	res := httptest.NewRecorder()
+	app.httpServer.Handler.ServeHTTP(res, req)
+
+	if got := strings.TrimSpace(res.Body.String()); got != "203.0.113.7" {
+		t.Fatalf("expected the address from the provider header, got %s", got)
+	}
+
+	cfg.Proxy.Presets[0].File = filepath.Join(dir, "missing.txt")
+
+	if _, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil || !strings.Contains(err.Error(), "load cloudflare ranges") {
+		t.Fatalf("expected an error for a missing range file, got %v", err)
+	}
+}
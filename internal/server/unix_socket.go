@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	errNotSocket   = errors.New("file exists and is not a socket")
+	errSocketInUse = errors.New("socket is in use by another process")
+)
+
+// listenUnix binds a Unix domain socket, replacing a stale socket file left behind by
+// a previous run, and applies the configured file mode and ownership.
+func (a *App) listenUnix(ctx context.Context, path string) (net.Listener, error) {
+	// Abstract sockets (Linux) have no file to clean up or set permissions on.
+	abstract := strings.HasPrefix(path, "@")
+
+	if !abstract {
+		if err := removeStaleSocket(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(ctx, "unix", path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // Wrapped by listenAddr.
+	}
+
+	if abstract {
+		return ln, nil
+	}
+
+	if mode := a.cfg.Server.UnixSocketMode; mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = ln.Close()
+
+			return nil, fmt.Errorf("set socket mode: %w", err)
+		}
+	}
+
+	if uid, gid := a.cfg.Server.UnixSocketUID, a.cfg.Server.UnixSocketGID; uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			_ = ln.Close()
+
+			return nil, fmt.Errorf("set socket owner: %w", err)
+		}
+	}
+
+	return ln, nil
+}
+
+func removeStaleSocket(ctx context.Context, path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("stat socket: %w", err)
+	}
+
+	if info.Mode().Type() != fs.ModeSocket {
+		return errNotSocket
+	}
+
+	var dialer net.Dialer
+
+	if conn, err := dialer.DialContext(ctx, "unix", path); err == nil {
+		_ = conn.Close()
+
+		return errSocketInUse
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+)
+
+func TestMultipleListeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ip-detect.sock")
+
+	cfg := config.Default()
+	cfg.Resolver.EnableReverseDNS = false
+	cfg.Server.Addrs = []config.ListenAddr{
+		{Network: "tcp4", Address: "127.0.0.1:0"},
+		{Network: "unix", Address: socket},
+	}
+	cfg.Server.UnixSocketMode = 0o600
+	cfg.Server.UnixSocketUID, cfg.Server.UnixSocketGID = os.Getuid(), os.Getgid()
+	cfg.Proxy.TrustForwarded = true
+	cfg.Proxy.TrustedSubnets = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	cfg.Proxy.TrustUnixSockets = true
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	listeners, _, err := app.listen(context.Background())
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	for _, ln := range listeners {
+		go func() {
+			_ = app.httpServer.Serve(ln)
+		}()
+	}
+
+	t.Cleanup(func() {
+		_ = app.httpServer.Close()
+	})
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+
+	if info.Mode().Type() != fs.ModeSocket || info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected socket mode: %v", info.Mode())
+	}
+
+	tcp := fetchJSON(t, http.DefaultClient, "http://"+listeners[0].Addr().String()+"/json")
+	if tcp.IPAddress != "127.0.0.1" {
+		t.Fatalf("unexpected TCP client IP: %q", tcp.IPAddress)
+	}
+
+	unixTransport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	// Act as a local proxy that forwards the client address.
+	unixClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("X-Forwarded-For", "198.51.100.3")
+
+		return unixTransport.RoundTrip(req)
+	})}
+
+	unix := fetchJSON(t, unixClient, "http://ip-detect/json")
+	if unix.Connection == nil || unix.Connection.Host == nil || *unix.Connection.Host != "ip-detect" {
+		t.Fatalf("unexpected connection info over unix socket: %+v", unix.Connection)
+	}
+
+	if unix.IPAddress != "198.51.100.3" {
+		t.Fatalf("expected the forwarded client IP over a trusted unix socket, got %q", unix.IPAddress)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestListenUnixReplacesStaleSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "stale.sock")
+	app := &App{cfg: config.Default()}
+
+	stale, err := app.listenUnix(context.Background(), socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	unixLn, ok := stale.(*net.UnixListener)
+	if !ok {
+		t.Fatalf("unexpected listener type %T", stale)
+	}
+
+	unixLn.SetUnlinkOnClose(false)
+	_ = unixLn.Close()
+
+	ln, err := app.listenUnix(context.Background(), socket)
+	if err != nil {
+		t.Fatalf("listen over stale socket: %v", err)
+	}
+	defer ln.Close()
+
+	if _, err := app.listenUnix(context.Background(), socket); err == nil {
+		t.Fatalf("expected an error for a socket in use")
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/systemd"
+)
+
+// Names of handed-over sockets. Stream sockets named "https" serve TLS, the same
+// convention as FileDescriptorName= for systemd socket activation.
+const (
+	socketNameHTTP  = "http"
+	socketNameHTTPS = "https"
+	socketNameHTTP3 = "http3"
+)
+
+// Environment variables passed to the upgraded child process.
+const (
+	upgradeFDsEnv     = "IPD_UPGRADE_FDS"
+	upgradeReadyFDEnv = "IPD_UPGRADE_READY_FD"
+)
+
+const (
+	// upgradeReadyTimeout bounds how long the old process waits for its successor.
+	upgradeReadyTimeout = time.Minute
+
+	// firstExtraFD is the descriptor of the first exec.Cmd.ExtraFiles entry in the child.
+	firstExtraFD = 3
+)
+
+var (
+	errUpgradeNoSockets = errors.New("no sockets to hand over")
+	errUpgradeChildExit = errors.New("new process exited before becoming ready")
+)
+
+// handoverSocket is a bound socket that can be passed to an upgraded process.
+type handoverSocket struct {
+	name string
+	conn interface{ File() (*os.File, error) }
+}
+
+func (a *App) trackSocket(name string, conn any) {
+	if filer, ok := conn.(interface{ File() (*os.File, error) }); ok {
+		a.sockets = append(a.sockets, handoverSocket{name: name, conn: filer})
+	}
+}
+
+// upgrade starts a new instance of the executable with all listening sockets and
+// waits until it reports that it is serving. On success the caller drains and exits.
+func (a *App) upgrade(ctx context.Context) error {
+	if len(a.sockets) == 0 {
+		return errUpgradeNoSockets
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate executable: %w", err)
+	}
+
+	files := make([]*os.File, 0, len(a.sockets)+1)
+	names := make([]string, 0, len(a.sockets))
+
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	for _, socket := range a.sockets {
+		f, err := socket.conn.File()
+		if err != nil {
+			return fmt.Errorf("duplicate %s socket: %w", socket.name, err)
+		}
+
+		files = append(files, f)
+		names = append(names, socket.name)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("create readiness pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	files = append(files, readyW)
+
+	// The new process outlives this one, so it must not be killed when ctx ends.
+	cmd := exec.CommandContext(context.WithoutCancel(ctx), executable, os.Args[1:]...) //nolint:gosec // Re-executes this binary.
+	cmd.Env = append(upgradeEnviron(),
+		upgradeFDsEnv+"="+strings.Join(names, ":"),
+		// The readiness pipe is the last of ExtraFiles.
+		upgradeReadyFDEnv+"="+strconv.Itoa(firstExtraFD+len(files)-1),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start new process: %w", err)
+	}
+
+	// Close our copy of the write end so that the read fails if the child dies.
+	_ = readyW.Close()
+
+	if err := waitUpgradeReady(readyR); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+
+		return err
+	}
+
+	// Reap the new process should it exit while this one is still draining.
+	go func() { _ = cmd.Wait() }()
+
+	a.logger.Info("new process is ready", "pid", cmd.Process.Pid)
+
+	if _, err := systemd.Notify("MAINPID=" + strconv.Itoa(cmd.Process.Pid)); err != nil {
+		a.logger.Warn("systemd notification failed", "state", "MAINPID", "error", err)
+	}
+
+	// The successor now owns the socket files; closing ours must not remove them.
+	for _, socket := range a.sockets {
+		if ln, ok := socket.conn.(*net.UnixListener); ok {
+			ln.SetUnlinkOnClose(false)
+		}
+	}
+
+	return nil
+}
+
+// upgradeEnviron returns the environment for the new process. WATCHDOG_PID names
+// this process, so it is left out for the successor to take over the watchdog once
+// it becomes the main PID.
+func upgradeEnviron() []string {
+	return slices.DeleteFunc(os.Environ(), func(entry string) bool {
+		return strings.HasPrefix(entry, "WATCHDOG_PID=")
+	})
+}
+
+func waitUpgradeReady(ready *os.File) error {
+	_ = ready.SetReadDeadline(time.Now().Add(upgradeReadyTimeout))
+
+	buf := make([]byte, 1)
+	if _, err := ready.Read(buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errUpgradeChildExit
+		}
+
+		return fmt.Errorf("wait for new process: %w", err)
+	}
+
+	return nil
+}
+
+// upgradeFiles returns the sockets handed over by a previous process, if this
+// process was started by an upgrade.
+func upgradeFiles() []*os.File {
+	value, ok := os.LookupEnv(upgradeFDsEnv)
+	if !ok {
+		return nil
+	}
+
+	_ = os.Unsetenv(upgradeFDsEnv)
+
+	names := strings.Split(value, ":")
+	files := make([]*os.File, 0, len(names))
+
+	for i, name := range names {
+		files = append(files, os.NewFile(uintptr(firstExtraFD+i), name))
+	}
+
+	return files
+}
+
+// signalUpgradeReady tells the previous process that this one is serving.
+func signalUpgradeReady() {
+	value, ok := os.LookupEnv(upgradeReadyFDEnv)
+	if !ok {
+		return
+	}
+
+	_ = os.Unsetenv(upgradeReadyFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+
+	ready := os.NewFile(uintptr(fd), "upgrade-ready")
+	_, _ = ready.Write([]byte{1})
+	_ = ready.Close()
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package server
+
+import "os"
+
+// upgradeSignals is empty where SIGUSR2 does not exist; upgrades are unavailable there.
+var upgradeSignals []os.Signal
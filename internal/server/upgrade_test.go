@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"git.skobk.in/skobkin/ip-detect/internal/config"
+	"git.skobk.in/skobkin/ip-detect/internal/systemd"
+)
+
+// upgradeReportEnv makes the test binary act as the upgraded process: it writes its
+// watchdog interval to the named file and reports that it is ready.
+const upgradeReportEnv = "IPD_TEST_UPGRADE_REPORT"
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(upgradeReportEnv); path != "" && os.Getenv(upgradeFDsEnv) != "" {
+		_ = os.WriteFile(path, []byte(systemd.WatchdogInterval().String()), 0o600)
+
+		signalUpgradeReady()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestRunDrainsInFlightRequests(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "drain.sock")
+
+	cfg := config.Default()
+	cfg.Server.Addrs = []config.ListenAddr{{Network: "unix", Address: socket}}
+
+	app, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	app.httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- app.Run(ctx)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			for {
+				conn, err := dialer.DialContext(ctx, "unix", socket)
+				if err == nil || ctx.Err() != nil {
+					return conn, err
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+		},
+	}}
+
+	body := make(chan string, 1)
+
+	go func() {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://ip-detect/", nil)
+
+		res, err := client.Do(req)
+		if err != nil {
+			body <- "error: " + err.Error()
+
+			return
+		}
+		defer res.Body.Close()
+
+		data, _ := io.ReadAll(res.Body)
+		body <- string(data)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned before the request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	if got := <-body; got != "done" {
+		t.Fatalf("unexpected response: %q", got)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestUpgradeReadiness(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		readyR, readyW, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("pipe: %v", err)
+		}
+		defer readyR.Close()
+
+		t.Setenv(upgradeReadyFDEnv, strconv.Itoa(int(readyW.Fd())))
+
+		signalUpgradeReady()
+
+		if err := waitUpgradeReady(readyR); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+
+		if _, ok := os.LookupEnv(upgradeReadyFDEnv); ok {
+			t.Fatalf("expected %s to be unset", upgradeReadyFDEnv)
+		}
+	})
+
+	t.Run("child exited", func(t *testing.T) {
+		readyR, readyW, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("pipe: %v", err)
+		}
+		defer readyR.Close()
+
+		_ = readyW.Close()
+
+		if err := waitUpgradeReady(readyR); !errors.Is(err, errUpgradeChildExit) {
+			t.Fatalf("expected child exit error, got %v", err)
+		}
+	})
+}
+
+func TestUpgradeHandsOverWatchdog(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "watchdog")
+
+	t.Setenv(upgradeReportEnv, report)
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	app := &App{cfg: config.Default(), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	app.trackSocket(socketNameHTTP, ln)
+
+	if err := app.upgrade(context.Background()); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+
+	interval, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+
+	if string(interval) != (30 * time.Second).String() {
+		t.Fatalf("expected the new process to own the watchdog, got interval %s", interval)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals trigger a handover of the listening sockets to a new process.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
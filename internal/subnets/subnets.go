@@ -0,0 +1,123 @@
+// Package subnets loads lists of network prefixes from files and shares them
+// between goroutines without locking.
+package subnets
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"git.skobk.in/skobkin/ip-detect/internal/fileerr"
+)
+
+// List is a set of prefixes that can be replaced while it is being read. The zero
+// value is an empty list; a nil *List contains nothing.
+type List struct {
+	prefixes atomic.Pointer[[]netip.Prefix]
+}
+
+// Load returns the current prefixes. The returned slice must not be modified.
+func (l *List) Load() []netip.Prefix {
+	if l == nil {
+		return nil
+	}
+
+	if prefixes := l.prefixes.Load(); prefixes != nil {
+		return *prefixes
+	}
+
+	return nil
+}
+
+// Store replaces the prefixes.
+func (l *List) Store(prefixes []netip.Prefix) {
+	l.prefixes.Store(&prefixes)
+}
+
+// Contains reports whether any prefix of the list contains ip.
+func (l *List) Contains(ip netip.Addr) bool {
+	return slices.ContainsFunc(l.Load(), func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
+// ReadFiles reads and concatenates the prefixes of every file.
+func ReadFiles(paths []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, path := range paths {
+		filePrefixes, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, filePrefixes...)
+	}
+
+	return prefixes, nil
+}
+
+func readFile(path string) ([]netip.Prefix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open subnet file: %w", err)
+	}
+	defer f.Close()
+
+	return parse(f, path)
+}
+
+// parse reads one prefix per line. Blank lines and text after "#" are ignored, and
+// a bare address stands for a single host. Errors are located in the file at path.
+func parse(r io.Reader, path string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		prefix, err := ParsePrefix(text)
+		if err != nil {
+			return nil, fileerr.Wrap(err, path, line)
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fileerr.Wrap(fmt.Errorf("read: %w", err), path, 0)
+	}
+
+	return prefixes, nil
+}
+
+// ParsePrefix parses a prefix in CIDR notation or a bare address, which stands for
+// a single host.
+func ParsePrefix(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("parse address %q: %w", value, err)
+		}
+
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("parse prefix %q: %w", value, err)
+	}
+
+	return prefix, nil
+}
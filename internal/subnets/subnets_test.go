@@ -0,0 +1,66 @@
+package subnets
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	first := filepath.Join(dir, "cdn-v4.txt")
+	second := filepath.Join(dir, "cdn-v6.txt")
+
+	writeFile(t, first, "# CDN edge networks\n10.0.0.0/8\n\n192.0.2.1 # single host\n")
+	writeFile(t, second, "2001:db8::/32\n")
+
+	got, err := ReadFiles([]string{first, second})
+	if err != nil {
+		t.Fatalf("ReadFiles: %v", err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("unexpected prefixes: %v", got)
+	}
+
+	writeFile(t, second, "2001:db8::/32\nnot-a-prefix/12\n")
+
+	if _, err := ReadFiles([]string{first, second}); err == nil || !strings.HasPrefix(err.Error(), second+":2: ") {
+		t.Fatalf("expected an error naming the file and line, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	var nilList *List
+	if nilList.Contains(netip.MustParseAddr("10.1.2.3")) {
+		t.Fatal("nil list must be empty")
+	}
+
+	var list List
+	if list.Contains(netip.MustParseAddr("10.1.2.3")) {
+		t.Fatal("zero list must be empty")
+	}
+
+	list.Store([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	if !list.Contains(netip.MustParseAddr("10.1.2.3")) || list.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Fatalf("unexpected membership for %v", list.Load())
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package systemd implements the parts of the systemd service protocol the server
+// uses: socket activation (LISTEN_FDS) and sd_notify readiness and watchdog messages.
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification states understood by the service manager.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+var errInvalidNotifySocket = errors.New("invalid NOTIFY_SOCKET")
+
+// ListenFiles returns the sockets passed to the process via socket activation, named
+// after the FileDescriptorName= of their socket units. The environment variables are
+// unset afterwards so that child processes do not mistake the sockets for their own.
+// It returns nil when the process was not socket-activated.
+func ListenFiles() []*os.File {
+	defer unsetListenEnv()
+
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	files := make([]*os.File, 0, count)
+
+	for i := range count {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		files = append(files, os.NewFile(uintptr(listenFDsStart+i), name))
+	}
+
+	return files
+}
+
+func unsetListenEnv() {
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+}
+
+// Notify sends a state update to the service manager. It reports false without an
+// error when the process is not supervised by systemd (NOTIFY_SOCKET is unset).
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	switch {
+	case strings.HasPrefix(socket, "@"):
+		// Abstract namespace socket.
+		socket = "\x00" + socket[1:]
+	case !strings.HasPrefix(socket, "/"):
+		return false, fmt.Errorf("%w: %q", errInvalidNotifySocket, socket)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("dial notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("send notification: %w", err)
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns how often the service manager expects WATCHDOG=1
+// notifications, or zero when the watchdog is not enabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,76 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Run("not supervised", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+
+		sent, err := Notify(Ready)
+		if sent || err != nil {
+			t.Fatalf("expected no-op, got sent=%v err=%v", sent, err)
+		}
+	})
+
+	t.Run("sends state", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "notify.sock")
+
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer conn.Close()
+
+		t.Setenv("NOTIFY_SOCKET", socket)
+
+		if sent, err := Notify(Ready); !sent || err != nil {
+			t.Fatalf("notify: sent=%v err=%v", sent, err)
+		}
+
+		buf := make([]byte, 64)
+
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		if got := string(buf[:n]); got != Ready {
+			t.Fatalf("unexpected state %q", got)
+		}
+	})
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	if got := WatchdogInterval(); got != 30*time.Second {
+		t.Fatalf("unexpected interval %v", got)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+
+	if got := WatchdogInterval(); got != 0 {
+		t.Fatalf("expected watchdog for another process to be ignored, got %v", got)
+	}
+}
+
+func TestListenFilesIgnoresOtherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	if files := ListenFiles(); files != nil {
+		t.Fatalf("expected no files, got %v", files)
+	}
+
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Fatalf("expected LISTEN_FDS to be unset")
+	}
+}